@@ -0,0 +1,171 @@
+package msgpraw
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+)
+
+var ErrDuplicateKey = errors.New("msgpraw: duplicate map key")
+
+// canonicalNaN is the quiet NaN every NaN is normalised to.
+const canonicalNaN = 0x7fc00000
+
+// Canonicalize re-encodes every value in buf in canonical form, so that two
+// messages carrying the same data compare equal byte for byte:
+//
+//   - integers use the shortest format; non-negative values always use the
+//     positive fixint/uint formats, negative values the negative fixint/int
+//     formats
+//   - str, bin, array, map and ext headers use the shortest format, with the
+//     fixext formats preferred for ext
+//   - a float64 that is exactly representable as float32 is written as
+//     Float32, and every NaN becomes the quiet NaN 0x7fc00000 as Float32
+//   - map pairs are sorted by the bytes of their encoded (canonical) keys;
+//     two equal keys in one map return ErrDuplicateKey
+//
+// Canonicalize is idempotent. The result is a new buffer; buf is not
+// modified.
+func Canonicalize(buf []byte) ([]byte, error) {
+	r := &MsgpReader{Buff: buf}
+	w := &MsgpWriter{Buff: make([]byte, 0, len(buf))}
+	for r.Idx < len(r.Buff) {
+		if err := canonicalValue(r, w, 0); err != nil {
+			return nil, err
+		}
+	}
+	return w.Buff, nil
+}
+
+func canonicalValue(r *MsgpReader, w *MsgpWriter, depth int) error {
+	if depth > maxDepth {
+		return ErrMaxDepth
+	}
+	t, n, data, err := r.Read()
+	if err == EOF && depth > 0 {
+		err = ErrTruncated
+	}
+	if err != nil {
+		return err
+	}
+	if i, isUint, ok := intPayload(t, data); ok {
+		if isUint {
+			return w.writeUintCompact(uint64(i))
+		}
+		return w.writeIntCompact(i)
+	}
+	if f, ok := floatPayload(t, data); ok {
+		return w.writeFloatCanonical(f)
+	}
+	switch {
+	case t == Nil:
+		return w.WriteNil()
+	case t == True, t == False:
+		return w.WriteBool(t == True)
+	case t.isStr():
+		return w.WriteString(string(data))
+	case t.isBin():
+		return w.WriteBytes(data)
+	case t.isExt():
+		return w.WriteExt(int8(data[0]), data[1:])
+	case t.isArray():
+		if n > len(r.Buff)-r.Idx {
+			return ErrTruncated
+		}
+		if err := w.WriteArray(n); err != nil {
+			return err
+		}
+		for i := 0; i < n; i++ {
+			if err := canonicalValue(r, w, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	case t.isMap():
+		if 2*n > len(r.Buff)-r.Idx {
+			return ErrTruncated
+		}
+		if err := w.WriteMap(n); err != nil {
+			return err
+		}
+		body := len(w.Buff)
+		for i := 0; i < 2*n; i++ {
+			if err := canonicalValue(r, w, depth+1); err != nil {
+				return err
+			}
+		}
+		return sortMap(w.Buff[body:])
+	}
+	return ErrUnknownType
+}
+
+// writeFloatCanonical writes f as Float32 when that loses nothing and as
+// Float64 otherwise. NaNs are written as the canonical quiet NaN.
+func (w *MsgpWriter) writeFloatCanonical(f float64) error {
+	if math.IsNaN(f) {
+		w.Buff = append(w.Buff, byte(Float32))
+		w.Buff = binary.BigEndian.AppendUint32(w.Buff, canonicalNaN)
+		return nil
+	}
+	if f32 := float32(f); float64(f32) == f {
+		return w.WriteFloat32(f32)
+	}
+	return w.WriteFloat64(f)
+}
+
+// sortMap sorts, in place, the key/value pairs making up body (the encoded
+// children of a map, and nothing after them) by the bytes of their keys.
+func sortMap(body []byte) error {
+	type pair struct{ key, val, end int } // offsets into body
+	var pairs []pair
+	r := MsgpReader{Buff: body}
+	for r.Idx < len(body) {
+		p := pair{key: r.Idx}
+		if err := r.SkipValue(); err != nil {
+			return err
+		}
+		p.val = r.Idx
+		if err := r.SkipValue(); err != nil {
+			if err == EOF {
+				err = ErrTruncated
+			}
+			return err
+		}
+		p.end = r.Idx
+		pairs = append(pairs, p)
+	}
+	if len(pairs) < 2 {
+		return nil
+	}
+	key := func(p pair) []byte { return body[p.key:p.val] }
+
+	sorted := true
+	for i := 1; i < len(pairs); i++ {
+		c := bytes.Compare(key(pairs[i-1]), key(pairs[i]))
+		if c == 0 {
+			return ErrDuplicateKey
+		}
+		if c > 0 {
+			sorted = false
+		}
+	}
+	if sorted {
+		return nil
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return bytes.Compare(key(pairs[i]), key(pairs[j])) < 0
+	})
+	for i := 1; i < len(pairs); i++ {
+		if bytes.Equal(key(pairs[i-1]), key(pairs[i])) {
+			return ErrDuplicateKey
+		}
+	}
+	scratch := make([]byte, 0, len(body))
+	for _, p := range pairs {
+		scratch = append(scratch, body[p.key:p.end]...)
+	}
+	copy(body, scratch)
+	return nil
+}
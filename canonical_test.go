@@ -0,0 +1,150 @@
+package msgpraw
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonicalize_Scalars(t *testing.T) {
+	cases := []struct {
+		name  string
+		write func(w *MsgpWriter) error
+		want  []byte
+	}{
+		{"int64_small", func(w *MsgpWriter) error { return w.WriteInt64(5) }, []byte{0x05}},
+		{"int8_positive", func(w *MsgpWriter) error { return w.WriteInt8(100) }, []byte{0x64}},
+		{"int16_positive", func(w *MsgpWriter) error { return w.WriteInt16(200) }, []byte{byte(Uint8), 200}},
+		{"int64_negative", func(w *MsgpWriter) error { return w.WriteInt64(-3) }, []byte{0xfd}},
+		{"int32_negative", func(w *MsgpWriter) error { return w.WriteInt32(-200) }, []byte{byte(Int16), 0xff, 0x38}},
+		{"uint64_small", func(w *MsgpWriter) error { return w.WriteUint64(300) }, []byte{byte(Uint16), 0x01, 0x2c}},
+		{"str16_short", func(w *MsgpWriter) error { return w.WriteStr16("ab") }, []byte{0xa2, 'a', 'b'}},
+		{"bin32_short", func(w *MsgpWriter) error { return w.WriteBin32([]byte{1}) }, []byte{byte(Bin8), 1, 1}},
+		{"ext8_fixed", func(w *MsgpWriter) error { return w.WriteExt8(3, []byte{1, 2}) }, []byte{byte(FixExt2), 3, 1, 2}},
+		{"array32_empty", func(w *MsgpWriter) error { return w.WriteArray32(0) }, []byte{0x90}},
+		{"float64_exact", func(w *MsgpWriter) error { return w.WriteFloat64(1.5) }, []byte{byte(Float32), 0x3f, 0xc0, 0, 0}},
+		{"float64_inexact", func(w *MsgpWriter) error { return w.WriteFloat64(0.1) },
+			[]byte{byte(Float64), 0x3f, 0xb9, 0x99, 0x99, 0x99, 0x99, 0x99, 0x9a}},
+		{"float64_nan", func(w *MsgpWriter) error { return w.WriteFloat64(math.Float64frombits(0x7ff0000000000001)) },
+			[]byte{byte(Float32), 0x7f, 0xc0, 0, 0}},
+		{"float32_nan", func(w *MsgpWriter) error { return w.WriteFloat32(math.Float32frombits(0xffc00001)) },
+			[]byte{byte(Float32), 0x7f, 0xc0, 0, 0}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := &MsgpWriter{}
+			require.NoError(t, tc.write(w))
+			got, err := Canonicalize(w.Buff)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestCanonicalize_SortsKeys(t *testing.T) {
+	w := &MsgpWriter{}
+	require.NoError(t, w.WriteMap16(3))
+	require.NoError(t, w.WriteStr8("b"))
+	require.NoError(t, w.WriteMap(2))
+	require.NoError(t, w.WriteInt64(2))
+	require.NoError(t, w.WriteNil())
+	require.NoError(t, w.WriteInt64(1))
+	require.NoError(t, w.WriteNil())
+	require.NoError(t, w.WriteString("a"))
+	require.NoError(t, w.WriteBool(true))
+	require.NoError(t, w.WriteInt8(1))
+	require.NoError(t, w.WriteBool(false))
+
+	got, err := Canonicalize(w.Buff)
+	require.NoError(t, err)
+
+	want := &MsgpWriter{}
+	require.NoError(t, want.WriteMap(3))
+	// 0x01 < 0xa1 'a' < 0xa1 'b'
+	require.NoError(t, want.WritePosFixInt(1))
+	require.NoError(t, want.WriteBool(false))
+	require.NoError(t, want.WriteString("a"))
+	require.NoError(t, want.WriteBool(true))
+	require.NoError(t, want.WriteString("b"))
+	require.NoError(t, want.WriteMap(2))
+	require.NoError(t, want.WritePosFixInt(1))
+	require.NoError(t, want.WriteNil())
+	require.NoError(t, want.WritePosFixInt(2))
+	require.NoError(t, want.WriteNil())
+	assert.Equal(t, want.Buff, got)
+}
+
+func TestCanonicalize_DuplicateKey(t *testing.T) {
+	// Int8(1) and PosFixInt(1) only collide after canonicalisation.
+	w := &MsgpWriter{}
+	require.NoError(t, w.WriteMap(2))
+	require.NoError(t, w.WriteInt8(1))
+	require.NoError(t, w.WriteNil())
+	require.NoError(t, w.WritePosFixInt(1))
+	require.NoError(t, w.WriteNil())
+	_, err := Canonicalize(w.Buff)
+	require.ErrorIs(t, err, ErrDuplicateKey)
+}
+
+func TestCanonicalize_Idempotent(t *testing.T) {
+	once, err := Canonicalize(allTagsFixture(t))
+	require.NoError(t, err)
+	twice, err := Canonicalize(once)
+	require.NoError(t, err)
+	assert.Equal(t, once, twice)
+}
+
+func TestCanonicalize_Errors(t *testing.T) {
+	cases := []struct {
+		name string
+		buf  []byte
+		err  error
+	}{
+		{"truncated_scalar", []byte{byte(Int16), 0x01}, ErrTruncated},
+		{"missing_element", []byte{byte(FixArray) | 2, 0x01}, ErrTruncated},
+		{"missing_value", []byte{byte(FixMap) | 1, 0x01}, ErrTruncated},
+		{"huge_count", []byte{byte(Map32), 0xff, 0xff, 0xff, 0xff, 0x01}, ErrTruncated},
+		{"unknown", []byte{byte(FixArray) | 1, 0xc1}, ErrUnknownType},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Canonicalize(tc.buf)
+			require.ErrorIs(t, err, tc.err)
+		})
+	}
+}
+
+func TestCheckedWriter_Canonical(t *testing.T) {
+	c := NewCheckedWriter(&MsgpWriter{})
+	c.Canonical = true
+	require.NoError(t, c.WriteMap32(2))
+	require.NoError(t, c.WriteStr16("z"))
+	require.NoError(t, c.WriteInt64(7))
+	require.NoError(t, c.WriteStr32("a"))
+	m, err := c.BeginMap()
+	require.NoError(t, err)
+	require.NoError(t, c.WriteString("y"))
+	require.NoError(t, c.WriteFloat64(0.5))
+	require.NoError(t, c.WriteString("x"))
+	require.NoError(t, c.WriteUint32(1))
+	require.NoError(t, c.End(m))
+	require.NoError(t, c.Complete())
+
+	want, err := Canonicalize(c.Buff)
+	require.NoError(t, err)
+	assert.Equal(t, want, c.Buff)
+	assert.Equal(t, byte(FixMap)|2, c.Buff[0])
+	assert.Equal(t, []byte{0xa1, 'a'}, c.Buff[1:3])
+}
+
+func TestCheckedWriter_CanonicalDuplicateKey(t *testing.T) {
+	c := NewCheckedWriter(&MsgpWriter{})
+	c.Canonical = true
+	require.NoError(t, c.WriteMap(2))
+	require.NoError(t, c.WriteString("k"))
+	require.NoError(t, c.WriteNil())
+	require.NoError(t, c.WriteStr8("k"))
+	require.ErrorIs(t, c.WriteNil(), ErrDuplicateKey)
+}
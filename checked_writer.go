@@ -0,0 +1,653 @@
+package msgpraw
+
+import "errors"
+
+var ErrContainerOverflow = errors.New("msgpraw: more values written than the enclosing container declared")
+
+// CheckedWriter wraps a MsgpWriter and verifies container element counts as
+// values are written. It keeps a stack of the arrays and maps opened through
+// it, so WriteMap(3) followed by five values is reported instead of silently
+// producing corrupt output.
+//
+// A CheckedWriter expects one top-level value per message. Once that value is
+// complete, any further write returns ErrContainerOverflow (the surplus of an
+// over-filled container ends up there) until Complete is called. Complete
+// returns ErrContainerIncomplete while any container is still open.
+//
+// The checks live in the wrapper so that the plain MsgpWriter methods stay
+// free of bookkeeping. Writes made directly on the embedded MsgpWriter
+// bypass them.
+type CheckedWriter struct {
+	*MsgpWriter
+
+	// Canonical makes every write use the canonical encoding produced by
+	// Canonicalize: explicit-width writers fall back to the shortest format
+	// for the value, floats are normalised, and each map's pairs are sorted
+	// by encoded key when its last value is written (or End is called). A
+	// duplicate key is reported as ErrDuplicateKey by that same call.
+	Canonical bool
+
+	open []checkedFrame
+	done bool
+}
+
+type checkedFrame struct {
+	deferred bool // opened by BeginArray/BeginMap, closed by End
+	isMap    bool
+	body     int // offset in Buff of a fixed-size container's first child
+	left     int // values still expected by a fixed-size container
+}
+
+// NewCheckedWriter returns a CheckedWriter appending to w.
+func NewCheckedWriter(w *MsgpWriter) *CheckedWriter {
+	return &CheckedWriter{MsgpWriter: w}
+}
+
+// Complete reports whether every container opened so far has received all of
+// its elements. On success the writer is ready for the next message.
+func (c *CheckedWriter) Complete() error {
+	if len(c.open) > 0 {
+		return ErrContainerIncomplete
+	}
+	c.done = false
+	return nil
+}
+
+// Depth returns the number of containers currently open.
+func (c *CheckedWriter) Depth() int { return len(c.open) }
+
+// check rejects a value that has no container left to go into.
+func (c *CheckedWriter) check() error {
+	if len(c.open) == 0 && c.done {
+		return ErrContainerOverflow
+	}
+	return nil
+}
+
+// wrote accounts for a complete value written through the wrapper.
+func (c *CheckedWriter) wrote(err error) error {
+	if err != nil {
+		return err
+	}
+	c.count()
+	return c.closeFull()
+}
+
+// opened accounts for an array or map header declaring n elements (pairs for
+// maps) that was just written.
+func (c *CheckedWriter) opened(isMap bool, n int, err error) error {
+	if err != nil {
+		return err
+	}
+	c.count()
+	want := n
+	if isMap {
+		want = 2 * n
+	}
+	if want == 0 {
+		return c.closeFull()
+	}
+	c.open = append(c.open, checkedFrame{isMap: isMap, body: len(c.Buff), left: want})
+	return nil
+}
+
+// count charges one value to the innermost open container.
+func (c *CheckedWriter) count() {
+	if len(c.open) > 0 {
+		if f := &c.open[len(c.open)-1]; !f.deferred {
+			f.left--
+		}
+	}
+}
+
+// closeFull pops fixed-size containers that received all of their values.
+func (c *CheckedWriter) closeFull() error {
+	for len(c.open) > 0 {
+		f := c.open[len(c.open)-1]
+		if f.deferred || f.left > 0 {
+			return nil
+		}
+		c.open = c.open[:len(c.open)-1]
+		if c.Canonical && f.isMap {
+			if err := sortMap(c.Buff[f.body:]); err != nil {
+				return err
+			}
+		}
+	}
+	c.done = true
+	return nil
+}
+
+// --- deferred containers -----------------------------------------------------
+
+// BeginArray is MsgpWriter.BeginArray with the new array tracked as open
+// until End. It returns ErrContainerOverflow if the message is already
+// complete.
+func (c *CheckedWriter) BeginArray() (Container, error) {
+	return c.begin(false)
+}
+
+// BeginMap is MsgpWriter.BeginMap with the new map tracked as open until
+// End. It returns ErrContainerOverflow if the message is already complete.
+func (c *CheckedWriter) BeginMap() (Container, error) {
+	return c.begin(true)
+}
+
+func (c *CheckedWriter) begin(isMap bool) (Container, error) {
+	if err := c.check(); err != nil {
+		return Container{}, err
+	}
+	c.count()
+	var h Container
+	if isMap {
+		h = c.MsgpWriter.BeginMap()
+	} else {
+		h = c.MsgpWriter.BeginArray()
+	}
+	c.open = append(c.open, checkedFrame{deferred: true, isMap: isMap})
+	return h, nil
+}
+
+// End closes a container opened by BeginArray or BeginMap. Fixed-size
+// containers inside it must be complete. In Canonical mode the header is
+// always compacted.
+func (c *CheckedWriter) End(h Container) error {
+	if len(c.open) > 0 && !c.open[len(c.open)-1].deferred {
+		return ErrContainerIncomplete
+	}
+	compact := c.CompactHeaders
+	c.CompactHeaders = compact || c.Canonical
+	err := c.MsgpWriter.End(h)
+	c.CompactHeaders = compact
+	if err != nil {
+		return err
+	}
+	if len(c.open) == 0 {
+		return c.closeFull()
+	}
+	f := c.open[len(c.open)-1]
+	c.open = c.open[:len(c.open)-1]
+	if c.Canonical && f.isMap {
+		r := MsgpReader{Buff: c.Buff, Idx: h.header}
+		_, _, body, _ := r.Read()
+		if err := sortMap(body); err != nil {
+			return err
+		}
+	}
+	return c.closeFull()
+}
+
+// --- values -----------------------------------------------------------------
+
+func (c *CheckedWriter) WritePosFixInt(i uint8) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	return c.wrote(c.MsgpWriter.WritePosFixInt(i))
+}
+
+func (c *CheckedWriter) WriteNegFixInt(i int8) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	return c.wrote(c.MsgpWriter.WriteNegFixInt(i))
+}
+
+func (c *CheckedWriter) WriteInt(i int) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	if c.Canonical {
+		return c.wrote(c.writeIntCompact(int64(i)))
+	}
+	return c.wrote(c.MsgpWriter.WriteInt(i))
+}
+
+func (c *CheckedWriter) WriteInt8(i int8) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	if c.Canonical {
+		return c.wrote(c.writeIntCompact(int64(i)))
+	}
+	return c.wrote(c.MsgpWriter.WriteInt8(i))
+}
+
+func (c *CheckedWriter) WriteInt16(i int16) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	if c.Canonical {
+		return c.wrote(c.writeIntCompact(int64(i)))
+	}
+	return c.wrote(c.MsgpWriter.WriteInt16(i))
+}
+
+func (c *CheckedWriter) WriteInt32(i int32) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	if c.Canonical {
+		return c.wrote(c.writeIntCompact(int64(i)))
+	}
+	return c.wrote(c.MsgpWriter.WriteInt32(i))
+}
+
+func (c *CheckedWriter) WriteInt64(i int64) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	if c.Canonical {
+		return c.wrote(c.writeIntCompact(i))
+	}
+	return c.wrote(c.MsgpWriter.WriteInt64(i))
+}
+
+func (c *CheckedWriter) WriteUint(u uint) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	if c.Canonical {
+		return c.wrote(c.writeUintCompact(uint64(u)))
+	}
+	return c.wrote(c.MsgpWriter.WriteUint(u))
+}
+
+func (c *CheckedWriter) WriteUint8(u uint8) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	if c.Canonical {
+		return c.wrote(c.writeUintCompact(uint64(u)))
+	}
+	return c.wrote(c.MsgpWriter.WriteUint8(u))
+}
+
+func (c *CheckedWriter) WriteUint16(u uint16) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	if c.Canonical {
+		return c.wrote(c.writeUintCompact(uint64(u)))
+	}
+	return c.wrote(c.MsgpWriter.WriteUint16(u))
+}
+
+func (c *CheckedWriter) WriteUint32(u uint32) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	if c.Canonical {
+		return c.wrote(c.writeUintCompact(uint64(u)))
+	}
+	return c.wrote(c.MsgpWriter.WriteUint32(u))
+}
+
+func (c *CheckedWriter) WriteUint64(u uint64) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	if c.Canonical {
+		return c.wrote(c.writeUintCompact(u))
+	}
+	return c.wrote(c.MsgpWriter.WriteUint64(u))
+}
+
+func (c *CheckedWriter) WriteFloat32(f float32) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	if c.Canonical {
+		return c.wrote(c.writeFloatCanonical(float64(f)))
+	}
+	return c.wrote(c.MsgpWriter.WriteFloat32(f))
+}
+
+func (c *CheckedWriter) WriteFloat64(f float64) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	if c.Canonical {
+		return c.wrote(c.writeFloatCanonical(f))
+	}
+	return c.wrote(c.MsgpWriter.WriteFloat64(f))
+}
+
+func (c *CheckedWriter) WriteNil() error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	return c.wrote(c.MsgpWriter.WriteNil())
+}
+
+func (c *CheckedWriter) WriteBool(b bool) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	return c.wrote(c.MsgpWriter.WriteBool(b))
+}
+
+func (c *CheckedWriter) WriteString(s string) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	return c.wrote(c.MsgpWriter.WriteString(s))
+}
+
+func (c *CheckedWriter) WriteFixStr(s string) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	return c.wrote(c.MsgpWriter.WriteFixStr(s))
+}
+
+func (c *CheckedWriter) WriteStr8(s string) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	if c.Canonical {
+		return c.wrote(c.MsgpWriter.WriteString(s))
+	}
+	return c.wrote(c.MsgpWriter.WriteStr8(s))
+}
+
+func (c *CheckedWriter) WriteStr16(s string) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	if c.Canonical {
+		return c.wrote(c.MsgpWriter.WriteString(s))
+	}
+	return c.wrote(c.MsgpWriter.WriteStr16(s))
+}
+
+func (c *CheckedWriter) WriteStr32(s string) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	if c.Canonical {
+		return c.wrote(c.MsgpWriter.WriteString(s))
+	}
+	return c.wrote(c.MsgpWriter.WriteStr32(s))
+}
+
+func (c *CheckedWriter) WriteBytes(b []byte) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	return c.wrote(c.MsgpWriter.WriteBytes(b))
+}
+
+func (c *CheckedWriter) WriteBin8(b []byte) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	return c.wrote(c.MsgpWriter.WriteBin8(b))
+}
+
+func (c *CheckedWriter) WriteBin16(b []byte) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	if c.Canonical {
+		return c.wrote(c.MsgpWriter.WriteBytes(b))
+	}
+	return c.wrote(c.MsgpWriter.WriteBin16(b))
+}
+
+func (c *CheckedWriter) WriteBin32(b []byte) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	if c.Canonical {
+		return c.wrote(c.MsgpWriter.WriteBytes(b))
+	}
+	return c.wrote(c.MsgpWriter.WriteBin32(b))
+}
+
+func (c *CheckedWriter) WriteExt(extType int8, data []byte) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	return c.wrote(c.MsgpWriter.WriteExt(extType, data))
+}
+
+func (c *CheckedWriter) WriteFixExt1(extType int8, data []byte) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	return c.wrote(c.MsgpWriter.WriteFixExt1(extType, data))
+}
+
+func (c *CheckedWriter) WriteFixExt2(extType int8, data []byte) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	return c.wrote(c.MsgpWriter.WriteFixExt2(extType, data))
+}
+
+func (c *CheckedWriter) WriteFixExt4(extType int8, data []byte) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	return c.wrote(c.MsgpWriter.WriteFixExt4(extType, data))
+}
+
+func (c *CheckedWriter) WriteFixExt8(extType int8, data []byte) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	return c.wrote(c.MsgpWriter.WriteFixExt8(extType, data))
+}
+
+func (c *CheckedWriter) WriteFixExt16(extType int8, data []byte) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	return c.wrote(c.MsgpWriter.WriteFixExt16(extType, data))
+}
+
+func (c *CheckedWriter) WriteExt8(extType int8, data []byte) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	if c.Canonical {
+		return c.wrote(c.MsgpWriter.WriteExt(extType, data))
+	}
+	return c.wrote(c.MsgpWriter.WriteExt8(extType, data))
+}
+
+func (c *CheckedWriter) WriteExt16(extType int8, data []byte) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	if c.Canonical {
+		return c.wrote(c.MsgpWriter.WriteExt(extType, data))
+	}
+	return c.wrote(c.MsgpWriter.WriteExt16(extType, data))
+}
+
+func (c *CheckedWriter) WriteExt32(extType int8, data []byte) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	if c.Canonical {
+		return c.wrote(c.MsgpWriter.WriteExt(extType, data))
+	}
+	return c.wrote(c.MsgpWriter.WriteExt32(extType, data))
+}
+
+// --- containers -------------------------------------------------------------
+
+func (c *CheckedWriter) WriteArray(n int) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	return c.opened(false, n, c.MsgpWriter.WriteArray(n))
+}
+
+func (c *CheckedWriter) WriteFixArray(n int) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	return c.opened(false, n, c.MsgpWriter.WriteFixArray(n))
+}
+
+func (c *CheckedWriter) WriteArray16(n int) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	if c.Canonical {
+		return c.opened(false, n, c.MsgpWriter.WriteArray(n))
+	}
+	return c.opened(false, n, c.MsgpWriter.WriteArray16(n))
+}
+
+func (c *CheckedWriter) WriteArray32(n int) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	if c.Canonical {
+		return c.opened(false, n, c.MsgpWriter.WriteArray(n))
+	}
+	return c.opened(false, n, c.MsgpWriter.WriteArray32(n))
+}
+
+func (c *CheckedWriter) WriteMap(n int) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	return c.opened(true, n, c.MsgpWriter.WriteMap(n))
+}
+
+func (c *CheckedWriter) WriteFixMap(n int) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	return c.opened(true, n, c.MsgpWriter.WriteFixMap(n))
+}
+
+func (c *CheckedWriter) WriteMap16(n int) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	if c.Canonical {
+		return c.opened(true, n, c.MsgpWriter.WriteMap(n))
+	}
+	return c.opened(true, n, c.MsgpWriter.WriteMap16(n))
+}
+
+func (c *CheckedWriter) WriteMap32(n int) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	if c.Canonical {
+		return c.opened(true, n, c.MsgpWriter.WriteMap(n))
+	}
+	return c.opened(true, n, c.MsgpWriter.WriteMap32(n))
+}
+
+// --- batched arrays ---------------------------------------------------------
+
+// The batched array writers count the array as one complete value. In
+// Canonical mode the elements are written one by one in their shortest
+// format instead of the fixed format of the plain writer.
+
+func (c *CheckedWriter) WriteFloat64Array(s []float64) error {
+	return checkedArray(c, s, c.MsgpWriter.WriteFloat64Array, c.writeFloatCanonical)
+}
+
+func (c *CheckedWriter) WriteFloat32Array(s []float32) error {
+	return checkedArray(c, s, c.MsgpWriter.WriteFloat32Array, func(f float32) error {
+		return c.writeFloatCanonical(float64(f))
+	})
+}
+
+func (c *CheckedWriter) WriteInt64Array(s []int64) error {
+	return checkedArray(c, s, c.MsgpWriter.WriteInt64Array, c.writeIntCompact)
+}
+
+func (c *CheckedWriter) WriteInt32Array(s []int32) error {
+	return checkedArray(c, s, c.MsgpWriter.WriteInt32Array, func(i int32) error {
+		return c.writeIntCompact(int64(i))
+	})
+}
+
+func (c *CheckedWriter) WriteInt16Array(s []int16) error {
+	return checkedArray(c, s, c.MsgpWriter.WriteInt16Array, func(i int16) error {
+		return c.writeIntCompact(int64(i))
+	})
+}
+
+func (c *CheckedWriter) WriteUint64Array(s []uint64) error {
+	return checkedArray(c, s, c.MsgpWriter.WriteUint64Array, c.writeUintCompact)
+}
+
+func (c *CheckedWriter) WriteUint32Array(s []uint32) error {
+	return checkedArray(c, s, c.MsgpWriter.WriteUint32Array, func(u uint32) error {
+		return c.writeUintCompact(uint64(u))
+	})
+}
+
+func (c *CheckedWriter) WriteUint16Array(s []uint16) error {
+	return checkedArray(c, s, c.MsgpWriter.WriteUint16Array, func(u uint16) error {
+		return c.writeUintCompact(uint64(u))
+	})
+}
+
+func checkedArray[T any](c *CheckedWriter, s []T, batched func([]T) error, canonical func(T) error) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	if !c.Canonical {
+		return c.wrote(batched(s))
+	}
+	if err := c.MsgpWriter.WriteArray(len(s)); err != nil {
+		return err
+	}
+	for _, v := range s {
+		if err := canonical(v); err != nil {
+			return err
+		}
+	}
+	return c.wrote(nil)
+}
+
+// WriteTypedArray is MsgpWriter.WriteTypedArray counted as one value. In
+// Canonical mode the ext header is shortened like Canonicalize does.
+func (c *CheckedWriter) WriteTypedArray(s any) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	start := len(c.Buff)
+	if err := c.MsgpWriter.WriteTypedArray(s); err != nil {
+		return err
+	}
+	if c.Canonical {
+		// Rewrite the Ext32 value in place: the payload moves left to where
+		// the shorter header ends, then WriteExt appends both over it.
+		payload := c.Buff[start+6:]
+		end := start + extHeaderLen(len(payload)) + len(payload)
+		copy(c.Buff[end-len(payload):], payload)
+		w := MsgpWriter{Buff: c.Buff[:start]}
+		if err := w.WriteExt(TypedArrayExt, c.Buff[end-len(payload):end]); err != nil {
+			return err
+		}
+		c.Buff = w.Buff
+	}
+	return c.wrote(nil)
+}
+
+// extHeaderLen returns the length of the shortest ext header, ext type byte
+// included, for n bytes of data.
+func extHeaderLen(n int) int {
+	switch {
+	case n == 1 || n == 2 || n == 4 || n == 8 || n == 16:
+		return 2
+	case n <= maxUint8:
+		return 3
+	case n <= maxUint16:
+		return 4
+	}
+	return 6
+}
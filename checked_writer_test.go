@@ -0,0 +1,212 @@
+package msgpraw
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// CheckedWriter is a drop-in IMsgpWriter.
+var _ IMsgpWriter = (*CheckedWriter)(nil)
+
+func TestCheckedWriter_Complete(t *testing.T) {
+	c := NewCheckedWriter(&MsgpWriter{})
+	require.NoError(t, c.WriteMap(2))
+	require.NoError(t, c.WriteString("a"))
+	require.NoError(t, c.WriteArray16(2))
+	require.NoError(t, c.WriteInt(1))
+	require.NoError(t, c.WriteFixMap(0))
+	assert.Equal(t, 1, c.Depth())
+	require.NoError(t, c.WriteString("b"))
+	require.NoError(t, c.WriteNil())
+	assert.Equal(t, 0, c.Depth())
+	require.NoError(t, c.Complete())
+
+	// After Complete the next message may start.
+	require.NoError(t, c.WriteBool(true))
+	require.NoError(t, c.Complete())
+
+	v, err := DecodeValue(&MsgpReader{Buff: c.Buff})
+	require.NoError(t, err)
+	assert.Equal(t, 2, v.Len())
+}
+
+func TestCheckedWriter_Underfilled(t *testing.T) {
+	// WriteMap(3) followed by five values.
+	c := NewCheckedWriter(&MsgpWriter{})
+	require.NoError(t, c.WriteMap(3))
+	for i := 0; i < 5; i++ {
+		require.NoError(t, c.WriteInt8(int8(i)))
+	}
+	require.ErrorIs(t, c.Complete(), ErrContainerIncomplete)
+}
+
+func TestCheckedWriter_Overfilled(t *testing.T) {
+	c := NewCheckedWriter(&MsgpWriter{})
+	require.NoError(t, c.WriteArray(2))
+	require.NoError(t, c.WriteMap(1))
+	require.NoError(t, c.WriteString("k"))
+	require.NoError(t, c.WriteNil())
+	// Surplus pair: the key lands in the outer array, the value has nowhere
+	// to go.
+	require.NoError(t, c.WriteString("k2"))
+	n := len(c.Buff)
+	require.ErrorIs(t, c.WriteNil(), ErrContainerOverflow)
+	assert.Equal(t, n, len(c.Buff), "rejected value must not be written")
+
+	require.ErrorIs(t, c.WriteExt(1, []byte{1}), ErrContainerOverflow)
+	_, err := c.BeginArray()
+	require.ErrorIs(t, err, ErrContainerOverflow)
+}
+
+func TestCheckedWriter_Deferred(t *testing.T) {
+	c := NewCheckedWriter(&MsgpWriter{})
+	outer, err := c.BeginMap()
+	require.NoError(t, err)
+	require.NoError(t, c.WriteString("rows"))
+	inner, err := c.BeginArray()
+	require.NoError(t, err)
+	require.NoError(t, c.WriteArray(2))
+	require.NoError(t, c.WriteNil())
+
+	// Inner fixed array is still missing a value.
+	require.ErrorIs(t, c.End(inner), ErrContainerIncomplete)
+	require.NoError(t, c.WriteNil())
+	require.ErrorIs(t, c.End(outer), ErrContainerIncomplete)
+	require.NoError(t, c.End(inner))
+	require.ErrorIs(t, c.Complete(), ErrContainerIncomplete)
+	require.NoError(t, c.End(outer))
+	require.NoError(t, c.Complete())
+
+	v, err := DecodeValue(&MsgpReader{Buff: c.Buff})
+	require.NoError(t, err)
+	rows, ok := v.Get("rows")
+	require.True(t, ok)
+	assert.Equal(t, 1, rows.Len())
+	assert.Equal(t, 2, rows.Index(0).Len())
+}
+
+func TestCheckedWriter_AllMethods(t *testing.T) {
+	c := NewCheckedWriter(&MsgpWriter{})
+	require.NoError(t, c.WriteArray32(40))
+	require.NoError(t, c.WritePosFixInt(1))
+	require.NoError(t, c.WriteNegFixInt(-1))
+	require.NoError(t, c.WriteInt(1))
+	require.NoError(t, c.WriteInt8(1))
+	require.NoError(t, c.WriteInt16(1))
+	require.NoError(t, c.WriteInt32(1))
+	require.NoError(t, c.WriteInt64(1))
+	require.NoError(t, c.WriteUint(1))
+	require.NoError(t, c.WriteUint8(1))
+	require.NoError(t, c.WriteUint16(1))
+	require.NoError(t, c.WriteUint32(1))
+	require.NoError(t, c.WriteUint64(1))
+	require.NoError(t, c.WriteFloat32(1))
+	require.NoError(t, c.WriteFloat64(1))
+	require.NoError(t, c.WriteNil())
+	require.NoError(t, c.WriteBool(true))
+	require.NoError(t, c.WriteString("s"))
+	require.NoError(t, c.WriteFixStr("s"))
+	require.NoError(t, c.WriteStr8("s"))
+	require.NoError(t, c.WriteStr16("s"))
+	require.NoError(t, c.WriteStr32("s"))
+	require.NoError(t, c.WriteBytes([]byte{1}))
+	require.NoError(t, c.WriteBin8([]byte{1}))
+	require.NoError(t, c.WriteBin16([]byte{1}))
+	require.NoError(t, c.WriteBin32([]byte{1}))
+	require.NoError(t, c.WriteArray(0))
+	require.NoError(t, c.WriteFixArray(0))
+	require.NoError(t, c.WriteArray16(0))
+	require.NoError(t, c.WriteMap(0))
+	require.NoError(t, c.WriteFixMap(0))
+	require.NoError(t, c.WriteMap16(0))
+	require.NoError(t, c.WriteMap32(0))
+	require.NoError(t, c.WriteExt(1, []byte{1}))
+	require.NoError(t, c.WriteFixExt1(1, make([]byte, 1)))
+	require.NoError(t, c.WriteFixExt2(1, make([]byte, 2)))
+	require.NoError(t, c.WriteFixExt4(1, make([]byte, 4)))
+	require.NoError(t, c.WriteFixExt8(1, make([]byte, 8)))
+	require.NoError(t, c.WriteFixExt16(1, make([]byte, 16)))
+	require.NoError(t, c.WriteExt8(1, []byte{1}))
+	assert.Equal(t, 1, c.Depth())
+	require.NoError(t, c.WriteExt16(1, []byte{1}))
+	assert.Equal(t, 0, c.Depth())
+	require.ErrorIs(t, c.WriteExt32(1, []byte{1}), ErrContainerOverflow)
+	require.NoError(t, c.Complete())
+	require.NoError(t, c.WriteExt32(1, []byte{1}))
+}
+
+func TestCheckedWriter_RangeErrorNotCounted(t *testing.T) {
+	c := NewCheckedWriter(&MsgpWriter{})
+	require.NoError(t, c.WriteArray(1))
+	require.ErrorIs(t, c.WriteFixStr(string(make([]byte, 40))), ErrFixStrRange)
+	require.ErrorIs(t, c.WriteFixArray(16), ErrFixArrayRange)
+	assert.Equal(t, 1, c.Depth())
+	require.NoError(t, c.WriteNil())
+	require.NoError(t, c.Complete())
+}
+
+func TestCheckedWriter_NumericArrays(t *testing.T) {
+	c := NewCheckedWriter(&MsgpWriter{})
+	require.NoError(t, c.WriteArray(8))
+	require.NoError(t, c.WriteFloat64Array([]float64{1, 2}))
+	require.NoError(t, c.WriteFloat32Array([]float32{1, 2}))
+	require.NoError(t, c.WriteInt64Array([]int64{1, 2}))
+	require.NoError(t, c.WriteInt32Array([]int32{1, 2}))
+	require.NoError(t, c.WriteInt16Array([]int16{1, 2}))
+	require.NoError(t, c.WriteUint64Array([]uint64{1, 2}))
+	require.NoError(t, c.WriteUint32Array([]uint32{1, 2}))
+	assert.Equal(t, 1, c.Depth())
+	require.NoError(t, c.WriteUint16Array([]uint16{1, 2}))
+	assert.Equal(t, 0, c.Depth())
+	require.ErrorIs(t, c.WriteInt64Array(nil), ErrContainerOverflow)
+	require.NoError(t, c.Complete())
+
+	// Canonical mode writes each element in its shortest format.
+	c = NewCheckedWriter(&MsgpWriter{})
+	c.Canonical = true
+	require.NoError(t, c.WriteMap(1))
+	require.NoError(t, c.WriteString("v"))
+	require.NoError(t, c.WriteInt64Array([]int64{1, -200, 1 << 40}))
+	require.NoError(t, c.Complete())
+	canon, err := Canonicalize(c.Buff)
+	require.NoError(t, err)
+	assert.Equal(t, canon, c.Buff)
+}
+
+func TestCheckedWriter_TypedArray(t *testing.T) {
+	c := NewCheckedWriter(&MsgpWriter{})
+	require.NoError(t, c.WriteArray(2))
+	require.NoError(t, c.WriteTypedArray([]int16{1, 2}))
+	assert.Equal(t, 1, c.Depth())
+	require.ErrorIs(t, c.WriteTypedArray([]string{"x"}), ErrTypedArrayElem)
+	require.NoError(t, c.WriteTypedArray([]float64{1}))
+	assert.Equal(t, 0, c.Depth())
+	require.ErrorIs(t, c.WriteTypedArray([]int8{1}), ErrContainerOverflow)
+	require.NoError(t, c.Complete())
+
+	for _, s := range []any{[]int8{7}, []uint8{1, 2, 3}, make([]uint16, 200), make([]int64, 10000)} {
+		c := NewCheckedWriter(&MsgpWriter{})
+		c.Canonical = true
+		require.NoError(t, c.WriteTypedArray(s))
+		canon, err := Canonicalize(c.Buff)
+		require.NoError(t, err)
+		assert.Equal(t, canon, c.Buff)
+
+		var got any
+		switch s.(type) {
+		case []int8:
+			got = &[]int8{}
+		case []uint8:
+			got = &[]uint8{}
+		case []uint16:
+			got = &[]uint16{}
+		case []int64:
+			got = &[]int64{}
+		}
+		require.NoError(t, (&MsgpReader{Buff: c.Buff}).ReadTypedArray(got))
+		assert.Equal(t, s, reflect.ValueOf(got).Elem().Interface())
+	}
+}
@@ -0,0 +1,279 @@
+package msgpraw
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// conformanceCase is one entry of testdata/conformance/msgpack-test-suite.json,
+// which uses the layout of the msgpack-test-suite fixtures (MIT licensed, see
+// LICENSE and SOURCE next to it). Each entry has a single key
+// naming the value's type (nil, bool, binary, number, bignum, string, array,
+// map, ext or timestamp) and holding it in JSON form, plus every accepted
+// encoding as dash-separated hex.
+type conformanceCase struct {
+	Kind    string
+	Value   json.RawMessage
+	Msgpack []string
+}
+
+func (c *conformanceCase) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for k, v := range fields {
+		if k == "msgpack" {
+			if err := json.Unmarshal(v, &c.Msgpack); err != nil {
+				return err
+			}
+			continue
+		}
+		c.Kind, c.Value = k, v
+	}
+	return nil
+}
+
+func loadConformance(t *testing.T) map[string][]conformanceCase {
+	data, err := os.ReadFile("testdata/conformance/msgpack-test-suite.json")
+	require.NoError(t, err)
+	var groups map[string][]conformanceCase
+	require.NoError(t, json.Unmarshal(data, &groups))
+	return groups
+}
+
+// want converts the JSON form of the case's value to a Value.
+func (c conformanceCase) want(t *testing.T) Value {
+	switch c.Kind {
+	case "binary":
+		var s string
+		require.NoError(t, json.Unmarshal(c.Value, &s))
+		return BinValue(unhex(t, s))
+	case "bignum":
+		var s string
+		require.NoError(t, json.Unmarshal(c.Value, &s))
+		return jsonNumber(t, json.Number(s))
+	case "ext":
+		var typ int8
+		var data string
+		pair := []any{&typ, &data}
+		require.NoError(t, json.Unmarshal(c.Value, &pair))
+		return ExtValue(typ, unhex(t, data))
+	case "timestamp":
+		ts := c.timestamp(t)
+		return ExtValue(-1, timestampPayload(ts[0], uint32(ts[1])))
+	}
+	return jsonValue(t, c.Value)
+}
+
+func (c conformanceCase) timestamp(t *testing.T) [2]int64 {
+	var ts [2]int64
+	require.NoError(t, json.Unmarshal(c.Value, &ts))
+	return ts
+}
+
+func unhex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(strings.ReplaceAll(s, "-", ""))
+	require.NoError(t, err)
+	return b
+}
+
+func jsonNumber(t *testing.T, n json.Number) Value {
+	if i, err := strconv.ParseInt(string(n), 10, 64); err == nil {
+		return IntValue(i)
+	}
+	if u, err := strconv.ParseUint(string(n), 10, 64); err == nil {
+		return UintValue(u)
+	}
+	f, err := n.Float64()
+	require.NoError(t, err)
+	return Float64Value(f)
+}
+
+// jsonValue converts nil, bool, number, string, array and map values. Maps
+// in the fixtures have at most one key per level, so key order never
+// matters.
+func jsonValue(t *testing.T, raw json.RawMessage) Value {
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+	var v any
+	require.NoError(t, d.Decode(&v))
+	return fromJSON(t, v)
+}
+
+func fromJSON(t *testing.T, v any) Value {
+	switch v := v.(type) {
+	case nil:
+		return NilValue()
+	case bool:
+		return BoolValue(v)
+	case json.Number:
+		return jsonNumber(t, v)
+	case string:
+		return StrValue(v)
+	case []any:
+		elems := make([]Value, len(v))
+		for i, e := range v {
+			elems[i] = fromJSON(t, e)
+		}
+		return ArrayValue(elems...)
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var kv []Value
+		for _, k := range keys {
+			kv = append(kv, StrValue(k), fromJSON(t, v[k]))
+		}
+		m, err := MapValue(kv...)
+		require.NoError(t, err)
+		return m
+	}
+	t.Fatalf("unexpected JSON value %T", v)
+	return Value{}
+}
+
+// timestampPayload picks the smallest of the timestamp ext formats.
+func timestampPayload(sec int64, nsec uint32) []byte {
+	switch {
+	case nsec == 0 && sec >= 0 && sec <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(nil, uint32(sec))
+	case sec >= 0 && sec < 1<<34:
+		return binary.BigEndian.AppendUint64(nil, uint64(nsec)<<34|uint64(sec))
+	default:
+		b := binary.BigEndian.AppendUint32(nil, nsec)
+		return binary.BigEndian.AppendUint64(b, uint64(sec))
+	}
+}
+
+// decodeTimestamp reads any of the three timestamp ext payloads.
+func decodeTimestamp(p []byte) (sec int64, nsec uint32, ok bool) {
+	switch len(p) {
+	case 4:
+		return int64(binary.BigEndian.Uint32(p)), 0, true
+	case 8:
+		v := binary.BigEndian.Uint64(p)
+		return int64(v & (1<<34 - 1)), uint32(v >> 34), true
+	case 12:
+		return int64(binary.BigEndian.Uint64(p[4:])), binary.BigEndian.Uint32(p), true
+	}
+	return 0, 0, false
+}
+
+// sameValue compares decoded values by meaning: numbers by numeric value
+// whatever their format, everything else exactly.
+func sameValue(got, want Value) bool {
+	if num(got) && num(want) {
+		return sameNumber(got, want)
+	}
+	if got.Kind() != want.Kind() {
+		return false
+	}
+	switch got.Kind() {
+	case KindNil:
+		return true
+	case KindBool:
+		return got.Bool() == want.Bool()
+	case KindStr, KindBin:
+		return bytes.Equal(got.Bytes(), want.Bytes())
+	case KindExt:
+		return got.ExtType() == want.ExtType() && bytes.Equal(got.Bytes(), want.Bytes())
+	case KindArray, KindMap:
+		if got.Len() != want.Len() {
+			return false
+		}
+		for i := 0; i < got.Len(); i++ {
+			if got.Kind() == KindArray && !sameValue(got.Index(i), want.Index(i)) {
+				return false
+			}
+			if got.Kind() == KindMap && (!sameValue(got.Key(i), want.Key(i)) || !sameValue(got.Elem(i), want.Elem(i))) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func num(v Value) bool {
+	k := v.Kind()
+	return k == KindInt || k == KindUint || k == KindFloat
+}
+
+func sameNumber(a, b Value) bool {
+	switch {
+	case a.Kind() == KindFloat || b.Kind() == KindFloat:
+		return toFloat(a) == toFloat(b)
+	case a.Kind() == b.Kind():
+		return a.Uint() == b.Uint()
+	default:
+		// Int vs Uint: equal only when both are the same non-negative value.
+		return a.Int() >= 0 && b.Int() >= 0 && a.Uint() == b.Uint()
+	}
+}
+
+func toFloat(v Value) float64 {
+	switch v.Kind() {
+	case KindInt:
+		return float64(v.Int())
+	case KindUint:
+		return float64(v.Uint())
+	}
+	return v.Float()
+}
+
+func TestConformance_Decode(t *testing.T) {
+	for group, cases := range loadConformance(t) {
+		for i, c := range cases {
+			want := c.want(t)
+			require.NotEmpty(t, c.Msgpack, "%s #%d", group, i)
+			for _, enc := range c.Msgpack {
+				buf := unhex(t, enc)
+				r := &MsgpReader{Buff: buf}
+				got, err := DecodeValue(r)
+				require.NoError(t, err, "%s #%d: %s", group, i, enc)
+				assert.Equal(t, len(buf), r.Idx, "%s #%d: %s", group, i, enc)
+				if c.Kind == "timestamp" {
+					sec, nsec, ok := decodeTimestamp(got.Bytes())
+					assert.True(t, ok && got.ExtType() == -1, "%s #%d: %s", group, i, enc)
+					assert.Equal(t, c.timestamp(t), [2]int64{sec, int64(nsec)}, "%s #%d: %s", group, i, enc)
+				} else {
+					assert.True(t, sameValue(got, want), "%s #%d: %s decoded to %+v", group, i, enc, got)
+				}
+
+				// SkipValue must agree on the extent.
+				r = &MsgpReader{Buff: buf}
+				require.NoError(t, r.SkipValue())
+				assert.Equal(t, len(buf), r.Idx, "%s #%d: %s", group, i, enc)
+			}
+		}
+	}
+}
+
+func TestConformance_Encode(t *testing.T) {
+	for group, cases := range loadConformance(t) {
+		for i, c := range cases {
+			w := &MsgpWriter{}
+			require.NoError(t, EncodeValue(w, c.want(t)), "%s #%d", group, i)
+			got := w.Buff
+			var dashed []string
+			for _, b := range got {
+				dashed = append(dashed, hex.EncodeToString([]byte{b}))
+			}
+			assert.Contains(t, c.Msgpack, strings.Join(dashed, "-"), "%s #%d", group, i)
+		}
+	}
+}
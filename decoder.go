@@ -0,0 +1,112 @@
+package msgpraw
+
+// Decoder splits a stream that arrives in arbitrary chunks into top-level
+// values without blocking. Feed appends bytes and Next returns the next
+// complete value, or ErrNeedMore when it has not fully arrived yet. Scanning
+// resumes where the previous call stopped, so a large value delivered in many
+// small chunks is only read once.
+type Decoder struct {
+	// MaxSize bounds the size of one value; a longer one is
+	// ErrFrameTooLarge. Zero means DefaultMaxFrameSize and a negative value
+	// no limit.
+	MaxSize int
+
+	buf     []byte
+	start   int // first byte of the value being scanned
+	scan    int // next header to read
+	pending int // values still to read before the current one is complete
+	err     error
+}
+
+// Feed appends p to the buffered input. Values returned by Next point into
+// that buffer and are only valid until the next call to Feed or Reset.
+func (d *Decoder) Feed(p []byte) {
+	if d.start > 0 && d.start == len(d.buf) {
+		d.buf = d.buf[:0]
+		d.scan -= d.start
+		d.start = 0
+	} else if d.start > 0 && len(d.buf)+len(p) > cap(d.buf) {
+		// Reclaim consumed space before append has to grow the buffer.
+		n := copy(d.buf, d.buf[d.start:])
+		d.buf = d.buf[:n]
+		d.scan -= d.start
+		d.start = 0
+	}
+	d.buf = append(d.buf, p...)
+}
+
+// Next returns the next complete top-level value. It returns ErrNeedMore if
+// the buffered input ends inside the value; feeding more bytes and calling
+// Next again continues from there. Any other error means the stream is
+// corrupt and is returned again by every later call until Reset.
+func (d *Decoder) Next() ([]byte, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	if d.pending == 0 {
+		d.scan, d.pending = d.start, 1
+	}
+	var err error
+	d.scan, d.pending, err = scanValue(d.buf, d.scan, d.pending)
+	if err == ErrNeedMore {
+		if limit := d.maxSize(); limit > 0 && len(d.buf)-d.start > limit {
+			d.err = ErrFrameTooLarge
+			return nil, d.err
+		}
+		return nil, err
+	}
+	if err != nil {
+		d.err = err
+		return nil, err
+	}
+	if limit := d.maxSize(); limit > 0 && d.scan-d.start > limit {
+		d.err = ErrFrameTooLarge
+		return nil, d.err
+	}
+	msg := d.buf[d.start:d.scan]
+	d.start = d.scan
+	return msg, nil
+}
+
+func (d *Decoder) maxSize() int {
+	if d.MaxSize == 0 {
+		return DefaultMaxFrameSize
+	}
+	return d.MaxSize
+}
+
+// scanValue continues scanning a value at buf[scan] with pending values
+// (headers and scalars) still to read, and returns where it stopped and how
+// many are left. A complete value leaves pending at 0; running out of input
+// is ErrNeedMore, with the progress so far returned for the next call.
+func scanValue(buf []byte, scan, pending int) (int, int, error) {
+	r := MsgpReader{Buff: buf, Idx: scan}
+	for pending > 0 {
+		t, n, _, err := r.Read()
+		if err == EOF || err == ErrTruncated {
+			return scan, pending, ErrNeedMore
+		}
+		if err != nil {
+			return scan, pending, err
+		}
+		scan = r.Idx
+		pending--
+		switch {
+		case t.isArray():
+			pending += n
+		case t.isMap():
+			pending += 2 * n
+		}
+	}
+	return scan, pending, nil
+}
+
+// Buffered returns the number of bytes fed but not yet returned by Next.
+func (d *Decoder) Buffered() int { return len(d.buf) - d.start }
+
+// Reset discards all buffered input and any error, keeping the buffer's
+// memory for reuse.
+func (d *Decoder) Reset() {
+	d.buf = d.buf[:0]
+	d.start, d.scan, d.pending, d.err = 0, 0, 0, nil
+}
@@ -0,0 +1,131 @@
+package msgpraw
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecoder_Chunks(t *testing.T) {
+	var stream []byte
+	var want [][]byte
+	for i := 0; i < 4; i++ {
+		w := &MsgpWriter{}
+		require.NoError(t, w.WriteMap(2))
+		require.NoError(t, w.WriteString("n"))
+		require.NoError(t, w.WriteInt(i))
+		require.NoError(t, w.WriteString("list"))
+		require.NoError(t, w.WriteArray(i))
+		for j := 0; j < i; j++ {
+			require.NoError(t, w.WriteString("item"))
+		}
+		want = append(want, w.Buff)
+		stream = append(stream, w.Buff...)
+	}
+
+	for _, chunk := range []int{1, 2, 3, 7, len(stream)} {
+		var d Decoder
+		var got [][]byte
+		for off := 0; off < len(stream); off += chunk {
+			end := off + chunk
+			if end > len(stream) {
+				end = len(stream)
+			}
+			d.Feed(stream[off:end])
+			for {
+				msg, err := d.Next()
+				if err == ErrNeedMore {
+					break
+				}
+				require.NoError(t, err)
+				// Copy: msg is only valid until the next Feed.
+				got = append(got, append([]byte(nil), msg...))
+			}
+		}
+		assert.Equal(t, want, got, "chunk %d", chunk)
+		assert.Zero(t, d.Buffered())
+	}
+}
+
+func TestDecoder_Resumes(t *testing.T) {
+	var d Decoder
+	d.Feed([]byte{byte(FixArray) | 3, 0x01})
+	_, err := d.Next()
+	require.ErrorIs(t, err, ErrNeedMore)
+	d.Feed([]byte{0x02})
+	_, err = d.Next()
+	require.ErrorIs(t, err, ErrNeedMore)
+	assert.Equal(t, 3, d.Buffered())
+
+	d.Feed([]byte{0x03, 0xc0})
+	msg, err := d.Next()
+	require.NoError(t, err)
+	assert.Equal(t, []byte{byte(FixArray) | 3, 0x01, 0x02, 0x03}, msg)
+	msg, err = d.Next()
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0xc0}, msg)
+	_, err = d.Next()
+	require.ErrorIs(t, err, ErrNeedMore)
+}
+
+func TestDecoder_Corrupt(t *testing.T) {
+	var d Decoder
+	d.Feed([]byte{0x01, byte(FixArray) | 2, 0xc1})
+	msg, err := d.Next()
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x01}, msg)
+
+	_, err = d.Next()
+	require.ErrorIs(t, err, ErrUnknownType)
+	d.Feed([]byte{0x01})
+	_, err = d.Next()
+	require.ErrorIs(t, err, ErrUnknownType, "errors are sticky")
+
+	d.Reset()
+	d.Feed([]byte{0x05})
+	msg, err = d.Next()
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x05}, msg)
+}
+
+func TestDecoder_MaxSize(t *testing.T) {
+	d := Decoder{MaxSize: 8}
+	d.Feed([]byte{byte(Array32), 0xff, 0xff, 0xff, 0xff})
+	_, err := d.Next()
+	require.ErrorIs(t, err, ErrNeedMore)
+	d.Feed(make([]byte, 8))
+	_, err = d.Next()
+	require.ErrorIs(t, err, ErrFrameTooLarge)
+
+	d = Decoder{MaxSize: 2}
+	d.Feed([]byte{byte(FixArray) | 2, 0x01, 0x02})
+	_, err = d.Next()
+	require.ErrorIs(t, err, ErrFrameTooLarge)
+
+	// The zero value is limited to DefaultMaxFrameSize; a negative MaxSize
+	// lifts the limit.
+	huge := append([]byte{byte(Bin32), 0xff, 0xff, 0xff, 0xff}, make([]byte, DefaultMaxFrameSize)...)
+	d = Decoder{}
+	d.Feed(huge)
+	_, err = d.Next()
+	require.ErrorIs(t, err, ErrFrameTooLarge)
+	d = Decoder{MaxSize: -1}
+	d.Feed(huge)
+	_, err = d.Next()
+	require.ErrorIs(t, err, ErrNeedMore)
+}
+
+func TestDecoder_NoAllocsSteadyState(t *testing.T) {
+	var d Decoder
+	chunk := []byte{byte(FixArray) | 2, 0x01}
+	rest := []byte{0x02, 0xc0}
+	allocs := testing.AllocsPerRun(100, func() {
+		d.Feed(chunk)
+		_, _ = d.Next()
+		d.Feed(rest)
+		_, _ = d.Next()
+		_, _ = d.Next()
+	})
+	require.Zero(t, allocs)
+}
@@ -0,0 +1,336 @@
+package msgpraw
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	ErrNotFound     = errors.New("msgpraw: key not found")
+	ErrIndexRange   = errors.New("msgpraw: index out of range")
+	ErrTypeMismatch = errors.New("msgpraw: value has a different type")
+	ErrIntOverflow  = errors.New("msgpraw: integer does not fit the requested type")
+)
+
+// Document is a read-only view over an encoded buffer. The first access to
+// an array or map records the offsets of its children, so repeated lookups
+// such as doc.Get("a").Index(3).Int() are O(1) and never copy Buff. A
+// Document is safe for concurrent use.
+type Document struct {
+	buf []byte
+
+	mu    sync.RWMutex
+	index map[int]*containerIndex
+}
+
+// containerIndex caches the layout of one array or map, keyed in Document by
+// the offset of its header.
+type containerIndex struct {
+	isMap bool
+	// children holds the offset of every element; for maps the offsets
+	// alternate key, value, key, value, ...
+	children []int
+	// keys and intKeys map string and integer keys to their pair index; the
+	// first occurrence of a duplicate key wins. intKeys stays nil for maps
+	// without integer keys.
+	keys    map[string]int
+	intKeys map[int64]int
+}
+
+// NewDocument returns a Document over the first value in buf.
+func NewDocument(buf []byte) *Document {
+	return &Document{buf: buf}
+}
+
+// Root returns the top-level value.
+func (d *Document) Root() Node { return Node{doc: d} }
+
+// Get is shorthand for d.Root().Get(key).
+func (d *Document) Get(key string) Node { return d.Root().Get(key) }
+
+// GetInt is shorthand for d.Root().GetInt(key).
+func (d *Document) GetInt(key int64) Node { return d.Root().GetInt(key) }
+
+// Index is shorthand for d.Root().Index(i).
+func (d *Document) Index(i int) Node { return d.Root().Index(i) }
+
+func (d *Document) container(off int) (*containerIndex, error) {
+	d.mu.RLock()
+	ci := d.index[off]
+	d.mu.RUnlock()
+	if ci != nil {
+		return ci, nil
+	}
+
+	r := MsgpReader{Buff: d.buf, Idx: off}
+	t, n, _, err := r.Read()
+	if err == EOF {
+		err = ErrTruncated
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !t.isArray() && !t.isMap() {
+		return nil, ErrTypeMismatch
+	}
+	ci = &containerIndex{isMap: t.isMap()}
+	count := n
+	if ci.isMap {
+		count = 2 * n
+	}
+	if count > len(d.buf)-r.Idx {
+		return nil, ErrTruncated
+	}
+	ci.children = make([]int, count)
+	for i := range ci.children {
+		ci.children[i] = r.Idx
+		if err := r.SkipValue(); err != nil {
+			if err == EOF {
+				err = ErrTruncated
+			}
+			return nil, err
+		}
+	}
+	if ci.isMap {
+		ci.keys = make(map[string]int, n)
+		for i := 0; i < n; i++ {
+			kr := MsgpReader{Buff: d.buf, Idx: ci.children[2*i]}
+			kt, _, data, _ := kr.Read()
+			if kt.isStr() {
+				if _, dup := ci.keys[string(data)]; !dup {
+					ci.keys[string(data)] = i
+				}
+				continue
+			}
+			v, isUint, ok := intPayload(kt, data)
+			if !ok || (isUint && v < 0) {
+				continue
+			}
+			if ci.intKeys == nil {
+				ci.intKeys = make(map[int64]int)
+			}
+			if _, dup := ci.intKeys[v]; !dup {
+				ci.intKeys[v] = i
+			}
+		}
+	}
+
+	d.mu.Lock()
+	if d.index == nil {
+		d.index = make(map[int]*containerIndex)
+	}
+	d.index[off] = ci
+	d.mu.Unlock()
+	return ci, nil
+}
+
+// Node is a position inside a Document. Lookups on a Node never fail
+// immediately; the first error is carried along the chain and reported by
+// the terminal accessor, so doc.Get("a").Index(3).Int() needs a single error
+// check.
+type Node struct {
+	doc *Document
+	off int
+	err error
+}
+
+// Err returns the error that made this Node invalid, if any.
+func (n Node) Err() error { return n.err }
+
+// Get returns the value stored under the string key of a map.
+func (n Node) Get(key string) Node {
+	if n.err != nil {
+		return n
+	}
+	ci, err := n.doc.container(n.off)
+	if err != nil {
+		return Node{doc: n.doc, err: err}
+	}
+	if !ci.isMap {
+		return Node{doc: n.doc, err: ErrTypeMismatch}
+	}
+	i, ok := ci.keys[key]
+	if !ok {
+		return Node{doc: n.doc, err: ErrNotFound}
+	}
+	return Node{doc: n.doc, off: ci.children[2*i+1]}
+}
+
+// GetInt returns the value stored under the integer key of a map. Keys match
+// by numeric value whatever their integer format.
+func (n Node) GetInt(key int64) Node {
+	if n.err != nil {
+		return n
+	}
+	ci, err := n.doc.container(n.off)
+	if err != nil {
+		return Node{doc: n.doc, err: err}
+	}
+	if !ci.isMap {
+		return Node{doc: n.doc, err: ErrTypeMismatch}
+	}
+	i, ok := ci.intKeys[key]
+	if !ok {
+		return Node{doc: n.doc, err: ErrNotFound}
+	}
+	return Node{doc: n.doc, off: ci.children[2*i+1]}
+}
+
+// Index returns element i of an array.
+func (n Node) Index(i int) Node {
+	if n.err != nil {
+		return n
+	}
+	ci, err := n.doc.container(n.off)
+	if err != nil {
+		return Node{doc: n.doc, err: err}
+	}
+	if ci.isMap {
+		return Node{doc: n.doc, err: ErrTypeMismatch}
+	}
+	if i < 0 || i >= len(ci.children) {
+		return Node{doc: n.doc, err: ErrIndexRange}
+	}
+	return Node{doc: n.doc, off: ci.children[i]}
+}
+
+// Len returns the element count of an array or the pair count of a map.
+func (n Node) Len() (int, error) {
+	t, count, _, err := n.read()
+	if err != nil {
+		return 0, err
+	}
+	if !t.isArray() && !t.isMap() {
+		return 0, ErrTypeMismatch
+	}
+	return count, nil
+}
+
+// Type returns the msgp tag of the value.
+func (n Node) Type() (Type, error) {
+	t, _, _, err := n.read()
+	return t, err
+}
+
+// Raw returns the complete encoding of the value, including the children of
+// arrays and maps, as a sub-slice of the Document's buffer.
+func (n Node) Raw() ([]byte, error) {
+	if n.err != nil {
+		return nil, n.err
+	}
+	r := MsgpReader{Buff: n.doc.buf, Idx: n.off}
+	if err := r.SkipValue(); err != nil {
+		return nil, err
+	}
+	return n.doc.buf[n.off:r.Idx], nil
+}
+
+func (n Node) IsNil() (bool, error) {
+	t, _, _, err := n.read()
+	return t == Nil, err
+}
+
+func (n Node) Bool() (bool, error) {
+	t, _, _, err := n.read()
+	if err != nil {
+		return false, err
+	}
+	if t != True && t != False {
+		return false, ErrTypeMismatch
+	}
+	return t == True, nil
+}
+
+// Int returns any integer format as int64.
+func (n Node) Int() (int64, error) {
+	t, _, data, err := n.read()
+	if err != nil {
+		return 0, err
+	}
+	i, isUint, ok := intPayload(t, data)
+	if !ok {
+		return 0, ErrTypeMismatch
+	}
+	if isUint && i < 0 {
+		return 0, ErrIntOverflow
+	}
+	return i, nil
+}
+
+// Uint returns any non-negative integer as uint64.
+func (n Node) Uint() (uint64, error) {
+	t, _, data, err := n.read()
+	if err != nil {
+		return 0, err
+	}
+	i, isUint, ok := intPayload(t, data)
+	if !ok {
+		return 0, ErrTypeMismatch
+	}
+	if !isUint && i < 0 {
+		return 0, ErrIntOverflow
+	}
+	return uint64(i), nil
+}
+
+// Float returns a Float32 or Float64 value as float64.
+func (n Node) Float() (float64, error) {
+	t, _, data, err := n.read()
+	if err != nil {
+		return 0, err
+	}
+	f, ok := floatPayload(t, data)
+	if !ok {
+		return 0, ErrTypeMismatch
+	}
+	return f, nil
+}
+
+// Str returns a string value. The result is a copy; use Bytes to avoid it.
+func (n Node) Str() (string, error) {
+	t, _, data, err := n.read()
+	if err != nil {
+		return "", err
+	}
+	if !t.isStr() {
+		return "", ErrTypeMismatch
+	}
+	return string(data), nil
+}
+
+// Bytes returns the payload of a Str or Bin value as a sub-slice of the
+// Document's buffer.
+func (n Node) Bytes() ([]byte, error) {
+	t, _, data, err := n.read()
+	if err != nil {
+		return nil, err
+	}
+	if !t.isStr() && !t.isBin() {
+		return nil, ErrTypeMismatch
+	}
+	return data, nil
+}
+
+// Ext returns the type and data of an ext value.
+func (n Node) Ext() (int8, []byte, error) {
+	t, _, data, err := n.read()
+	if err != nil {
+		return 0, nil, err
+	}
+	if !t.isExt() {
+		return 0, nil, ErrTypeMismatch
+	}
+	return int8(data[0]), data[1:], nil
+}
+
+func (n Node) read() (Type, int, []byte, error) {
+	if n.err != nil {
+		return 0, 0, nil, n.err
+	}
+	r := MsgpReader{Buff: n.doc.buf, Idx: n.off}
+	t, count, data, err := r.Read()
+	if err == EOF {
+		err = ErrTruncated
+	}
+	return t, count, data, err
+}
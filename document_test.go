@@ -0,0 +1,180 @@
+package msgpraw
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// documentFixture encodes
+//
+//	{"a": [0, -1, "two", 3.5, {"deep": true}], "b": bin(2), "c": nil, "e": ext(7, 1 byte)}
+func documentFixture(t *testing.T) []byte {
+	w := &MsgpWriter{}
+	require.NoError(t, w.WriteMap(4))
+	require.NoError(t, w.WriteString("a"))
+	require.NoError(t, w.WriteArray(5))
+	require.NoError(t, w.WritePosFixInt(0))
+	require.NoError(t, w.WriteNegFixInt(-1))
+	require.NoError(t, w.WriteString("two"))
+	require.NoError(t, w.WriteFloat64(3.5))
+	require.NoError(t, w.WriteMap(1))
+	require.NoError(t, w.WriteString("deep"))
+	require.NoError(t, w.WriteBool(true))
+	require.NoError(t, w.WriteString("b"))
+	require.NoError(t, w.WriteBytes([]byte{1, 2}))
+	require.NoError(t, w.WriteString("c"))
+	require.NoError(t, w.WriteNil())
+	require.NoError(t, w.WriteString("e"))
+	require.NoError(t, w.WriteFixExt1(7, []byte{9}))
+	return w.Buff
+}
+
+func TestDocument_Lookups(t *testing.T) {
+	doc := NewDocument(documentFixture(t))
+
+	i, err := doc.Get("a").Index(1).Int()
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), i)
+
+	s, err := doc.Get("a").Index(2).Str()
+	require.NoError(t, err)
+	assert.Equal(t, "two", s)
+
+	f, err := doc.Get("a").Index(3).Float()
+	require.NoError(t, err)
+	assert.Equal(t, 3.5, f)
+
+	b, err := doc.Get("a").Index(4).Get("deep").Bool()
+	require.NoError(t, err)
+	assert.True(t, b)
+
+	bin, err := doc.Get("b").Bytes()
+	require.NoError(t, err)
+	assert.Equal(t, []byte{1, 2}, bin)
+
+	isNil, err := doc.Get("c").IsNil()
+	require.NoError(t, err)
+	assert.True(t, isNil)
+
+	et, data, err := doc.Get("e").Ext()
+	require.NoError(t, err)
+	assert.Equal(t, int8(7), et)
+	assert.Equal(t, []byte{9}, data)
+
+	n, err := doc.Root().Len()
+	require.NoError(t, err)
+	assert.Equal(t, 4, n)
+
+	n, err = doc.Get("a").Len()
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+}
+
+func TestDocument_ZeroCopy(t *testing.T) {
+	buf := documentFixture(t)
+	doc := NewDocument(buf)
+
+	raw, err := doc.Get("a").Index(4).Raw()
+	require.NoError(t, err)
+	assert.Equal(t, []byte{byte(FixMap) | 1, byte(FixStr) | 4, 'd', 'e', 'e', 'p', byte(True)}, raw)
+
+	// Raw is a window into buf, not a copy.
+	off := bytes.Index(buf, raw)
+	require.GreaterOrEqual(t, off, 0)
+	assert.Same(t, &buf[off], &raw[0])
+}
+
+func TestDocument_CachesOffsets(t *testing.T) {
+	doc := NewDocument(documentFixture(t))
+	_, err := doc.Get("a").Index(0).Int()
+	require.NoError(t, err)
+	require.Len(t, doc.index, 2)
+
+	// Repeated lookups reuse the index and do not allocate.
+	allocs := testing.AllocsPerRun(100, func() {
+		_, _ = doc.Get("a").Index(0).Int()
+	})
+	assert.Zero(t, allocs)
+	assert.Len(t, doc.index, 2)
+}
+
+func TestDocument_Errors(t *testing.T) {
+	doc := NewDocument(documentFixture(t))
+
+	_, err := doc.Get("missing").Index(0).Int()
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = doc.Get("a").Index(5).Int()
+	assert.ErrorIs(t, err, ErrIndexRange)
+
+	_, err = doc.Get("a").Get("x").Int()
+	assert.ErrorIs(t, err, ErrTypeMismatch)
+
+	_, err = doc.Index(0).Int()
+	assert.ErrorIs(t, err, ErrTypeMismatch)
+
+	_, err = doc.Get("a").Index(2).Int()
+	assert.ErrorIs(t, err, ErrTypeMismatch)
+
+	_, err = doc.Get("a").Index(1).Uint()
+	assert.ErrorIs(t, err, ErrIntOverflow)
+
+	assert.ErrorIs(t, doc.Get("nope").Err(), ErrNotFound)
+
+	truncated := NewDocument([]byte{byte(FixArray) | 3, 0x01})
+	_, err = truncated.Index(0).Int()
+	assert.ErrorIs(t, err, ErrTruncated)
+}
+
+func TestDocument_Concurrent(t *testing.T) {
+	doc := NewDocument(documentFixture(t))
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				v, err := doc.Get("a").Index(4).Get("deep").Bool()
+				assert.NoError(t, err)
+				assert.True(t, v)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkDocument_Get(b *testing.B) {
+	w := &MsgpWriter{}
+	_ = w.WriteMap(1)
+	_ = w.WriteString("a")
+	_ = w.WriteArray(100)
+	for i := 0; i < 100; i++ {
+		_ = w.WriteInt(i)
+	}
+	doc := NewDocument(w.Buff)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = doc.Get("a").Index(i % 100).Int()
+	}
+}
+
+func TestDocument_GetInt(t *testing.T) {
+	doc := NewDocument(compactKeysFixture(t))
+	for key, want := range map[int64]string{5: "five", -2: "minus two", 300: "three hundred"} {
+		s, err := doc.GetInt(key).Str()
+		require.NoError(t, err)
+		assert.Equal(t, want, s)
+	}
+	require.ErrorIs(t, doc.GetInt(-1<<63).Err(), ErrNotFound, "Uint64 1<<63 is not int64 -1<<63")
+	require.ErrorIs(t, doc.GetInt(7).Err(), ErrNotFound)
+	s, err := doc.Get("name").Str()
+	require.NoError(t, err)
+	assert.Equal(t, "n", s)
+
+	require.ErrorIs(t, NewDocument([]byte{0x90}).GetInt(1).Err(), ErrTypeMismatch)
+}
@@ -0,0 +1,208 @@
+package msgpraw
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+var (
+	ErrNeedMore      = errors.New("msgpraw: need more bytes")
+	ErrFrameTooLarge = errors.New("msgpraw: frame exceeds the maximum size")
+	ErrFrameInvalid  = errors.New("msgpraw: frame is not exactly one msgpack value")
+)
+
+// FrameMode selects how messages are delimited on a stream.
+type FrameMode int
+
+const (
+	// FrameLengthPrefix precedes every message with its length as a 4-byte
+	// big-endian unsigned integer.
+	FrameLengthPrefix FrameMode = iota
+	// FrameSelfDelimiting sends messages back to back; each must be exactly
+	// one msgpack value, whose end is found by skipping over it.
+	FrameSelfDelimiting
+)
+
+// DefaultMaxFrameSize is the MaxSize of a FrameReader created by
+// NewFrameReader.
+const DefaultMaxFrameSize = 16 << 20
+
+const framePrefixSize = 4
+
+// NextFrame finds the first message in buf. It returns the message, as a
+// sub-slice of buf, and the number of bytes it occupies including any
+// prefix. If buf holds only the beginning of a message it returns
+// ErrNeedMore; other errors mean the stream is corrupt.
+func NextFrame(buf []byte, mode FrameMode) (msg []byte, n int, err error) {
+	switch mode {
+	case FrameLengthPrefix:
+		if len(buf) < framePrefixSize {
+			return nil, 0, ErrNeedMore
+		}
+		size := binary.BigEndian.Uint32(buf)
+		if uint64(len(buf)-framePrefixSize) < uint64(size) {
+			return nil, 0, ErrNeedMore
+		}
+		n = framePrefixSize + int(size)
+		return buf[framePrefixSize:n], n, nil
+	case FrameSelfDelimiting:
+		r := MsgpReader{Buff: buf}
+		if err := r.SkipValue(); err != nil {
+			if err == EOF || err == ErrTruncated {
+				return nil, 0, ErrNeedMore
+			}
+			return nil, 0, err
+		}
+		return buf[:r.Idx], r.Idx, nil
+	}
+	return nil, 0, ErrFrameInvalid
+}
+
+// FrameWriter writes framed messages to W.
+type FrameWriter struct {
+	W    io.Writer
+	Mode FrameMode
+
+	buf []byte
+}
+
+func NewFrameWriter(w io.Writer, mode FrameMode) *FrameWriter {
+	return &FrameWriter{W: w, Mode: mode}
+}
+
+// WriteFrame writes msg as one frame with a single call to W.Write. In
+// FrameSelfDelimiting mode msg must hold exactly one value, otherwise
+// ErrFrameInvalid is returned and nothing is written.
+func (f *FrameWriter) WriteFrame(msg []byte) error {
+	switch f.Mode {
+	case FrameLengthPrefix:
+		if uint64(len(msg)) > maxUint32 {
+			return ErrFrameTooLarge
+		}
+		f.buf = binary.BigEndian.AppendUint32(f.buf[:0], uint32(len(msg)))
+		f.buf = append(f.buf, msg...)
+		_, err := f.W.Write(f.buf)
+		return err
+	case FrameSelfDelimiting:
+		r := MsgpReader{Buff: msg}
+		if err := r.SkipValue(); err != nil || r.Idx != len(msg) {
+			return ErrFrameInvalid
+		}
+		_, err := f.W.Write(msg)
+		return err
+	}
+	return ErrFrameInvalid
+}
+
+// FrameReader splits the stream read from R into messages.
+type FrameReader struct {
+	R    io.Reader
+	Mode FrameMode
+	// MaxSize bounds the size of one message; a longer one is
+	// ErrFrameTooLarge. Zero means no limit.
+	MaxSize int
+
+	buf        []byte
+	start, end int // unconsumed bytes are buf[start:end]
+	// FrameSelfDelimiting: progress through the message at start, kept
+	// between fills so that it is scanned only once.
+	scan, pending int
+}
+
+func NewFrameReader(r io.Reader, mode FrameMode) *FrameReader {
+	return &FrameReader{R: r, Mode: mode, MaxSize: DefaultMaxFrameSize}
+}
+
+// ReadFrame returns the next message. The result points into the reader's
+// buffer and is only valid until the next call. At the end of the stream it
+// returns io.EOF, or io.ErrUnexpectedEOF if the stream stops inside a
+// message.
+func (f *FrameReader) ReadFrame() ([]byte, error) {
+	for {
+		msg, n, err := f.next()
+		if err == nil {
+			if f.MaxSize > 0 && len(msg) > f.MaxSize {
+				return nil, ErrFrameTooLarge
+			}
+			f.start += n
+			return msg, nil
+		}
+		if err != ErrNeedMore {
+			return nil, err
+		}
+		if err := f.checkPending(); err != nil {
+			return nil, err
+		}
+		if err := f.fill(); err != nil {
+			if err == io.EOF && f.end > f.start {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+	}
+}
+
+// next is NextFrame on the unconsumed bytes, resuming the scan of a
+// self-delimiting message where the previous call stopped.
+func (f *FrameReader) next() ([]byte, int, error) {
+	if f.Mode != FrameSelfDelimiting {
+		return NextFrame(f.buf[f.start:f.end], f.Mode)
+	}
+	if f.pending == 0 {
+		f.scan, f.pending = f.start, 1
+	}
+	var err error
+	f.scan, f.pending, err = scanValue(f.buf[:f.end], f.scan, f.pending)
+	if err != nil {
+		return nil, 0, err
+	}
+	return f.buf[f.start:f.scan], f.scan - f.start, nil
+}
+
+// checkPending rejects an incomplete message that can already be seen to
+// exceed MaxSize.
+func (f *FrameReader) checkPending() error {
+	if f.MaxSize <= 0 {
+		return nil
+	}
+	pending := f.buf[f.start:f.end]
+	if f.Mode == FrameLengthPrefix {
+		if len(pending) >= framePrefixSize && uint64(binary.BigEndian.Uint32(pending)) > uint64(f.MaxSize) {
+			return ErrFrameTooLarge
+		}
+		return nil
+	}
+	if len(pending) > f.MaxSize {
+		return ErrFrameTooLarge
+	}
+	return nil
+}
+
+// fill reads at least one more byte from R, compacting or growing buf first.
+func (f *FrameReader) fill() error {
+	if f.start > 0 {
+		f.end = copy(f.buf, f.buf[f.start:f.end])
+		f.scan -= f.start
+		f.start = 0
+	}
+	if f.end == len(f.buf) {
+		size := 2 * len(f.buf)
+		if size < 4096 {
+			size = 4096
+		}
+		grown := make([]byte, size)
+		copy(grown, f.buf[:f.end])
+		f.buf = grown
+	}
+	for {
+		n, err := f.R.Read(f.buf[f.end:])
+		f.end += n
+		if n > 0 {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package msgpraw
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func frameMessages(t *testing.T) [][]byte {
+	var msgs [][]byte
+	for i := 0; i < 3; i++ {
+		w := &MsgpWriter{}
+		require.NoError(t, w.WriteMap(2))
+		require.NoError(t, w.WriteString("seq"))
+		require.NoError(t, w.WriteInt(i))
+		require.NoError(t, w.WriteString("body"))
+		require.NoError(t, w.WriteBytes(bytes.Repeat([]byte{byte(i)}, 100*i)))
+		msgs = append(msgs, w.Buff)
+	}
+	return msgs
+}
+
+func TestFrame_RoundTrip(t *testing.T) {
+	for _, mode := range []FrameMode{FrameLengthPrefix, FrameSelfDelimiting} {
+		var stream bytes.Buffer
+		fw := NewFrameWriter(&stream, mode)
+		msgs := frameMessages(t)
+		for _, m := range msgs {
+			require.NoError(t, fw.WriteFrame(m))
+		}
+
+		// One byte at a time exercises every partial-buffer state.
+		fr := NewFrameReader(iotest.OneByteReader(bytes.NewReader(stream.Bytes())), mode)
+		for _, want := range msgs {
+			got, err := fr.ReadFrame()
+			require.NoError(t, err, "mode %d", mode)
+			assert.Equal(t, want, got)
+		}
+		_, err := fr.ReadFrame()
+		require.ErrorIs(t, err, io.EOF)
+	}
+}
+
+func TestNextFrame(t *testing.T) {
+	msg := []byte{byte(FixArray) | 2, 0x01, 0x02}
+
+	prefixed := append([]byte{0, 0, 0, 3}, msg...)
+	for i := 0; i < len(prefixed); i++ {
+		_, _, err := NextFrame(prefixed[:i], FrameLengthPrefix)
+		require.ErrorIs(t, err, ErrNeedMore, "len %d", i)
+	}
+	got, n, err := NextFrame(append(prefixed, 0xff), FrameLengthPrefix)
+	require.NoError(t, err)
+	assert.Equal(t, msg, got)
+	assert.Equal(t, 7, n)
+
+	for i := 0; i < len(msg); i++ {
+		_, _, err := NextFrame(msg[:i], FrameSelfDelimiting)
+		require.ErrorIs(t, err, ErrNeedMore, "len %d", i)
+	}
+	got, n, err = NextFrame(append(msg, 0xc0), FrameSelfDelimiting)
+	require.NoError(t, err)
+	assert.Equal(t, msg, got)
+	assert.Equal(t, 3, n)
+
+	_, _, err = NextFrame([]byte{byte(FixArray) | 1, 0xc1}, FrameSelfDelimiting)
+	require.ErrorIs(t, err, ErrUnknownType, "corruption is not ErrNeedMore")
+}
+
+func TestFrameWriter_Invalid(t *testing.T) {
+	var stream bytes.Buffer
+	fw := NewFrameWriter(&stream, FrameSelfDelimiting)
+	require.ErrorIs(t, fw.WriteFrame([]byte{0xc0, 0xc0}), ErrFrameInvalid)
+	require.ErrorIs(t, fw.WriteFrame([]byte{byte(FixArray) | 1}), ErrFrameInvalid)
+	assert.Zero(t, stream.Len())
+}
+
+func TestFrameReader_Errors(t *testing.T) {
+	// Stream ends mid-message.
+	fr := NewFrameReader(bytes.NewReader([]byte{0, 0, 0, 5, 1}), FrameLengthPrefix)
+	_, err := fr.ReadFrame()
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	// Declared length over the limit is rejected before it is buffered.
+	fr = NewFrameReader(bytes.NewReader([]byte{0x7f, 0, 0, 0}), FrameLengthPrefix)
+	fr.MaxSize = 1024
+	_, err = fr.ReadFrame()
+	require.ErrorIs(t, err, ErrFrameTooLarge)
+
+	// A self-delimited value that keeps growing past the limit.
+	huge := append([]byte{byte(Bin32), 0, 1, 0, 0}, make([]byte, 2048)...)
+	fr = NewFrameReader(bytes.NewReader(huge), FrameSelfDelimiting)
+	fr.MaxSize = 1024
+	_, err = fr.ReadFrame()
+	require.ErrorIs(t, err, ErrFrameTooLarge)
+
+	// Corruption.
+	fr = NewFrameReader(bytes.NewReader([]byte{0xc1}), FrameSelfDelimiting)
+	_, err = fr.ReadFrame()
+	require.ErrorIs(t, err, ErrUnknownType)
+}
+
+// chunkReader returns at most n bytes per Read, like a slow network peer.
+type chunkReader struct {
+	r io.Reader
+	n int
+}
+
+func (c chunkReader) Read(p []byte) (int, error) {
+	if len(p) > c.n {
+		p = p[:c.n]
+	}
+	return c.r.Read(p)
+}
+
+func TestFrameReader_LargeValueInChunks(t *testing.T) {
+	// A 4 MB array of nils followed by a second message, 1500 bytes at a
+	// time. Rescanning the array after every read would take tens of seconds.
+	w := &MsgpWriter{}
+	require.NoError(t, w.WriteArray32(4<<20))
+	w.Buff = append(w.Buff, bytes.Repeat([]byte{byte(Nil)}, 4<<20)...)
+	big := w.Buff
+	stream := append(append([]byte(nil), big...), byte(True))
+
+	start := time.Now()
+	fr := NewFrameReader(chunkReader{bytes.NewReader(stream), 1500}, FrameSelfDelimiting)
+	msg, err := fr.ReadFrame()
+	require.NoError(t, err)
+	assert.Equal(t, big, msg)
+	msg, err = fr.ReadFrame()
+	require.NoError(t, err)
+	assert.Equal(t, []byte{byte(True)}, msg)
+	_, err = fr.ReadFrame()
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestFrameReader_NoAllocsSteadyState(t *testing.T) {
+	var stream bytes.Buffer
+	fw := NewFrameWriter(&stream, FrameLengthPrefix)
+	for i := 0; i < 200; i++ {
+		require.NoError(t, fw.WriteFrame([]byte{0xc0}))
+	}
+	r := bytes.NewReader(stream.Bytes())
+	fr := NewFrameReader(r, FrameLengthPrefix)
+	_, err := fr.ReadFrame()
+	require.NoError(t, err)
+	allocs := testing.AllocsPerRun(100, func() {
+		_, _ = fr.ReadFrame()
+	})
+	require.Zero(t, allocs)
+}
@@ -0,0 +1,320 @@
+package msgpraw
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+// fuzzSeeds returns every value of allTagsFixture on its own and cut one
+// byte short. Values over maxFuzzSeed bytes are left out, as large inputs
+// slow the fuzzer's mutator to a crawl.
+func fuzzSeeds(f *testing.F) [][]byte {
+	buf := allTagsFixture(f)
+	var seeds [][]byte
+	r := MsgpReader{Buff: buf}
+	for r.Idx < len(buf) {
+		start := r.Idx
+		if err := r.SkipValue(); err != nil {
+			f.Fatal(err)
+		}
+		v := buf[start:r.Idx]
+		if len(v) > maxFuzzSeed {
+			continue
+		}
+		seeds = append(seeds, v, v[:len(v)-1])
+	}
+	return seeds
+}
+
+const maxFuzzSeed = 4096
+
+// fullSlice caps buf at its length, so any read past the end panics instead
+// of silently reaching into spare capacity.
+func fullSlice(data []byte) []byte {
+	return append([]byte(nil), data...)[:len(data):len(data)]
+}
+
+func FuzzRead(f *testing.F) {
+	for _, s := range fuzzSeeds(f) {
+		f.Add(s)
+	}
+	f.Add([]byte{byte(Array32), 0xff, 0xff, 0xff, 0xff})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		buf := fullSlice(data)
+		for _, strict := range []bool{false, true} {
+			r := MsgpReader{Buff: buf, Strict: strict}
+			for {
+				prev := r.Idx
+				typ, _, payload, err := r.Read()
+				if r.Idx < prev || r.Idx > len(buf) {
+					t.Fatalf("Idx %d out of range after %d (len %d)", r.Idx, prev, len(buf))
+				}
+				if err != nil {
+					break
+				}
+				if r.Idx == prev {
+					t.Fatalf("Read of %#x made no progress", byte(typ))
+				}
+				if len(payload) > len(buf)-prev {
+					t.Fatalf("payload of %d bytes exceeds the input", len(payload))
+				}
+			}
+		}
+	})
+}
+
+func FuzzSkip(f *testing.F) {
+	for _, s := range fuzzSeeds(f) {
+		f.Add(s)
+	}
+	f.Add(bytes.Repeat([]byte{byte(FixArray) | 1}, 2*maxDepth))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		buf := fullSlice(data)
+		r := MsgpReader{Buff: buf}
+		for {
+			prev := r.Idx
+			err := r.SkipValue()
+			if r.Idx > len(buf) {
+				t.Fatalf("Idx %d past the input (len %d)", r.Idx, len(buf))
+			}
+			if err != nil {
+				break
+			}
+			if r.Idx == prev {
+				t.Fatal("SkipValue made no progress")
+			}
+			// Whatever SkipValue accepts must decode as one value of the
+			// same extent.
+			d := MsgpReader{Buff: buf[:r.Idx], Idx: prev}
+			if _, err := DecodeValue(&d); err != nil || d.Idx != r.Idx {
+				t.Fatalf("DecodeValue disagrees with SkipValue: %v at %d, want %d", err, d.Idx, r.Idx)
+			}
+		}
+	})
+}
+
+// roundTripOps writes one value with a MsgpWriter method each. The value is
+// derived from the fuzzer's i and s; check verifies what Read returns.
+var roundTripOps = []func(w *MsgpWriter, i int64, s []byte) (check func(Type, int, []byte) bool, err error){
+	func(w *MsgpWriter, i int64, s []byte) (func(Type, int, []byte) bool, error) {
+		return wantInt(i), w.WriteInt(int(i))
+	},
+	func(w *MsgpWriter, i int64, s []byte) (func(Type, int, []byte) bool, error) {
+		return wantInt(int64(int8(i))), w.WriteInt8(int8(i))
+	},
+	func(w *MsgpWriter, i int64, s []byte) (func(Type, int, []byte) bool, error) {
+		return wantInt(int64(int16(i))), w.WriteInt16(int16(i))
+	},
+	func(w *MsgpWriter, i int64, s []byte) (func(Type, int, []byte) bool, error) {
+		return wantInt(int64(int32(i))), w.WriteInt32(int32(i))
+	},
+	func(w *MsgpWriter, i int64, s []byte) (func(Type, int, []byte) bool, error) {
+		return wantInt(i), w.WriteInt64(i)
+	},
+	func(w *MsgpWriter, i int64, s []byte) (func(Type, int, []byte) bool, error) {
+		return wantUint(uint64(uint8(i))), w.WriteUint8(uint8(i))
+	},
+	func(w *MsgpWriter, i int64, s []byte) (func(Type, int, []byte) bool, error) {
+		return wantUint(uint64(uint16(i))), w.WriteUint16(uint16(i))
+	},
+	func(w *MsgpWriter, i int64, s []byte) (func(Type, int, []byte) bool, error) {
+		return wantUint(uint64(uint32(i))), w.WriteUint32(uint32(i))
+	},
+	func(w *MsgpWriter, i int64, s []byte) (func(Type, int, []byte) bool, error) {
+		return wantUint(uint64(i)), w.WriteUint64(uint64(i))
+	},
+	func(w *MsgpWriter, i int64, s []byte) (func(Type, int, []byte) bool, error) {
+		return wantInt(int64(uint8(i))), w.WritePosFixInt(uint8(i))
+	},
+	func(w *MsgpWriter, i int64, s []byte) (func(Type, int, []byte) bool, error) {
+		return wantInt(int64(int8(i))), w.WriteNegFixInt(int8(i))
+	},
+	func(w *MsgpWriter, i int64, s []byte) (func(Type, int, []byte) bool, error) {
+		return func(t Type, _ int, _ []byte) bool { return t == Nil }, w.WriteNil()
+	},
+	func(w *MsgpWriter, i int64, s []byte) (func(Type, int, []byte) bool, error) {
+		want := Type(False)
+		if i&1 != 0 {
+			want = True
+		}
+		return func(t Type, _ int, _ []byte) bool { return t == want }, w.WriteBool(i&1 != 0)
+	},
+	func(w *MsgpWriter, i int64, s []byte) (func(Type, int, []byte) bool, error) {
+		f := math.Float32frombits(uint32(i))
+		return func(t Type, _ int, data []byte) bool {
+			got, ok := floatPayload(t, data)
+			return ok && t == Float32 && sameFloat(got, float64(f))
+		}, w.WriteFloat32(f)
+	},
+	func(w *MsgpWriter, i int64, s []byte) (func(Type, int, []byte) bool, error) {
+		f := math.Float64frombits(uint64(i))
+		return func(t Type, _ int, data []byte) bool {
+			got, ok := floatPayload(t, data)
+			return ok && t == Float64 && math.Float64bits(got) == uint64(i)
+		}, w.WriteFloat64(f)
+	},
+	func(w *MsgpWriter, i int64, s []byte) (func(Type, int, []byte) bool, error) {
+		return wantPayload(Type.isStr, s), w.WriteString(string(s))
+	},
+	func(w *MsgpWriter, i int64, s []byte) (func(Type, int, []byte) bool, error) {
+		return wantPayload(Type.isStr, s), w.WriteFixStr(string(s))
+	},
+	func(w *MsgpWriter, i int64, s []byte) (func(Type, int, []byte) bool, error) {
+		return wantPayload(Type.isStr, s), w.WriteStr8(string(s))
+	},
+	func(w *MsgpWriter, i int64, s []byte) (func(Type, int, []byte) bool, error) {
+		return wantPayload(Type.isStr, s), w.WriteStr16(string(s))
+	},
+	func(w *MsgpWriter, i int64, s []byte) (func(Type, int, []byte) bool, error) {
+		return wantPayload(Type.isStr, s), w.WriteStr32(string(s))
+	},
+	func(w *MsgpWriter, i int64, s []byte) (func(Type, int, []byte) bool, error) {
+		return wantPayload(Type.isBin, s), w.WriteBytes(s)
+	},
+	func(w *MsgpWriter, i int64, s []byte) (func(Type, int, []byte) bool, error) {
+		return wantPayload(Type.isBin, s), w.WriteBin8(s)
+	},
+	func(w *MsgpWriter, i int64, s []byte) (func(Type, int, []byte) bool, error) {
+		return wantPayload(Type.isBin, s), w.WriteBin16(s)
+	},
+	func(w *MsgpWriter, i int64, s []byte) (func(Type, int, []byte) bool, error) {
+		return wantPayload(Type.isBin, s), w.WriteBin32(s)
+	},
+	func(w *MsgpWriter, i int64, s []byte) (func(Type, int, []byte) bool, error) {
+		return wantExt(int8(i), s), w.WriteExt(int8(i), s)
+	},
+	func(w *MsgpWriter, i int64, s []byte) (func(Type, int, []byte) bool, error) {
+		return wantExt(int8(i), s), w.WriteFixExt1(int8(i), s)
+	},
+	func(w *MsgpWriter, i int64, s []byte) (func(Type, int, []byte) bool, error) {
+		return wantExt(int8(i), s), w.WriteFixExt2(int8(i), s)
+	},
+	func(w *MsgpWriter, i int64, s []byte) (func(Type, int, []byte) bool, error) {
+		return wantExt(int8(i), s), w.WriteFixExt4(int8(i), s)
+	},
+	func(w *MsgpWriter, i int64, s []byte) (func(Type, int, []byte) bool, error) {
+		return wantExt(int8(i), s), w.WriteFixExt8(int8(i), s)
+	},
+	func(w *MsgpWriter, i int64, s []byte) (func(Type, int, []byte) bool, error) {
+		return wantExt(int8(i), s), w.WriteFixExt16(int8(i), s)
+	},
+	func(w *MsgpWriter, i int64, s []byte) (func(Type, int, []byte) bool, error) {
+		return wantExt(int8(i), s), w.WriteExt8(int8(i), s)
+	},
+	func(w *MsgpWriter, i int64, s []byte) (func(Type, int, []byte) bool, error) {
+		return wantExt(int8(i), s), w.WriteExt16(int8(i), s)
+	},
+	func(w *MsgpWriter, i int64, s []byte) (func(Type, int, []byte) bool, error) {
+		return wantExt(int8(i), s), w.WriteExt32(int8(i), s)
+	},
+	func(w *MsgpWriter, i int64, s []byte) (func(Type, int, []byte) bool, error) {
+		return wantCount(Type.isArray, int(uint16(i))), w.WriteArray(int(uint16(i)))
+	},
+	func(w *MsgpWriter, i int64, s []byte) (func(Type, int, []byte) bool, error) {
+		return wantCount(Type.isArray, int(i&0x1f)), w.WriteFixArray(int(i & 0x1f))
+	},
+	func(w *MsgpWriter, i int64, s []byte) (func(Type, int, []byte) bool, error) {
+		return wantCount(Type.isArray, int(uint16(i))), w.WriteArray16(int(uint16(i)))
+	},
+	func(w *MsgpWriter, i int64, s []byte) (func(Type, int, []byte) bool, error) {
+		return wantCount(Type.isArray, int(uint32(i))), w.WriteArray32(int(uint32(i)))
+	},
+	func(w *MsgpWriter, i int64, s []byte) (func(Type, int, []byte) bool, error) {
+		return wantCount(Type.isMap, int(uint16(i))), w.WriteMap(int(uint16(i)))
+	},
+	func(w *MsgpWriter, i int64, s []byte) (func(Type, int, []byte) bool, error) {
+		return wantCount(Type.isMap, int(i&0x1f)), w.WriteFixMap(int(i & 0x1f))
+	},
+	func(w *MsgpWriter, i int64, s []byte) (func(Type, int, []byte) bool, error) {
+		return wantCount(Type.isMap, int(uint16(i))), w.WriteMap16(int(uint16(i)))
+	},
+	func(w *MsgpWriter, i int64, s []byte) (func(Type, int, []byte) bool, error) {
+		return wantCount(Type.isMap, int(uint32(i))), w.WriteMap32(int(uint32(i)))
+	},
+}
+
+func wantInt(want int64) func(Type, int, []byte) bool {
+	return func(t Type, _ int, data []byte) bool {
+		got, isUint, ok := intPayload(t, data)
+		return ok && got == want && (!isUint || want >= 0)
+	}
+}
+
+func wantUint(want uint64) func(Type, int, []byte) bool {
+	return func(t Type, _ int, data []byte) bool {
+		got, _, ok := intPayload(t, data)
+		return ok && uint64(got) == want
+	}
+}
+
+func wantPayload(is func(Type) bool, want []byte) func(Type, int, []byte) bool {
+	return func(t Type, _ int, data []byte) bool { return is(t) && bytes.Equal(data, want) }
+}
+
+func wantExt(extType int8, want []byte) func(Type, int, []byte) bool {
+	return func(t Type, _ int, data []byte) bool {
+		return t.isExt() && int8(data[0]) == extType && bytes.Equal(data[1:], want)
+	}
+}
+
+func wantCount(is func(Type) bool, want int) func(Type, int, []byte) bool {
+	return func(t Type, n int, _ []byte) bool { return is(t) && n == want }
+}
+
+// sameFloat compares bit patterns, treating all NaNs alike since widening a
+// signaling NaN may quiet it.
+func sameFloat(a, b float64) bool {
+	if math.IsNaN(a) || math.IsNaN(b) {
+		return math.IsNaN(a) && math.IsNaN(b)
+	}
+	return math.Float64bits(a) == math.Float64bits(b)
+}
+
+func FuzzRoundTrip(f *testing.F) {
+	// Every writer is seeded with the integers and str/bin/ext payloads of
+	// the fixture's values, plus the edges of every size class.
+	ints := []int64{0, -1, 200, -300, 40000, -70000, 1 << 40, math.MinInt64}
+	payloads := [][]byte{nil, make([]byte, 300)}
+	r := MsgpReader{Buff: allTagsFixture(f)}
+	for {
+		t, _, data, err := r.Read()
+		if err != nil {
+			break
+		}
+		if i, _, ok := intPayload(t, data); ok {
+			ints = append(ints, i)
+		} else if t.isStr() || t.isBin() || t.isExt() {
+			payloads = append(payloads, data)
+		}
+	}
+	for op := range roundTripOps {
+		for _, s := range payloads {
+			for _, i := range ints {
+				f.Add(uint8(op), i, s)
+			}
+		}
+	}
+	f.Fuzz(func(t *testing.T, op uint8, i int64, s []byte) {
+		w := &MsgpWriter{}
+		check, err := roundTripOps[int(op)%len(roundTripOps)](w, i, s)
+		if err != nil {
+			// Out of range for an explicit format; nothing may be written.
+			if len(w.Buff) != 0 {
+				t.Fatalf("op %d failed with %v but wrote % x", op, err, w.Buff)
+			}
+			return
+		}
+		r := MsgpReader{Buff: fullSlice(w.Buff)}
+		typ, n, data, err := r.Read()
+		if err != nil {
+			t.Fatalf("op %d: reading % x: %v", op, w.Buff, err)
+		}
+		if r.Idx != len(w.Buff) {
+			t.Fatalf("op %d: read %d of %d bytes", op, r.Idx, len(w.Buff))
+		}
+		if !check(typ, n, data) {
+			t.Fatalf("op %d: % x read back as %#x n=%d payload % x", op, w.Buff, byte(typ), n, data)
+		}
+	})
+}
@@ -0,0 +1,130 @@
+package msgpraw
+
+import "sort"
+
+// SchemaInferrer merges many messages into a summary of the field paths
+// they contain and the kinds observed at each path.
+//
+// Paths start at "$". A string map key k appends ".k", any other key ".*",
+// and an array element "[]": {"user": {"tags": ["a"]}} yields "$",
+// "$.user", "$.user.tags" and "$.user.tags[]". Keys themselves are not
+// recorded as fields.
+type SchemaInferrer struct {
+	messages int
+	fields   map[string]*FieldSummary
+	path     []byte
+}
+
+// FieldSummary describes one path seen by a SchemaInferrer.
+type FieldSummary struct {
+	Path string
+	// Messages is the number of messages in which the path occurred at
+	// least once, Count the total number of occurrences.
+	Messages int
+	Count    int
+	// Kinds counts the occurrences per Kind.
+	Kinds map[Kind]int
+	// Optional is set by Fields when some message lacked the path.
+	Optional bool
+
+	lastMsg int
+}
+
+// Add merges every top-level value of buf, each counted as one message. On
+// error the summary keeps whatever was merged before the error. Only paths
+// and kinds not seen before allocate.
+func (s *SchemaInferrer) Add(buf []byte) error {
+	if s.fields == nil {
+		s.fields = make(map[string]*FieldSummary)
+	}
+	r := &MsgpReader{Buff: buf}
+	for r.Idx < len(r.Buff) {
+		s.messages++
+		s.path = append(s.path[:0], '$')
+		if err := s.value(r, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Messages returns the number of messages added.
+func (s *SchemaInferrer) Messages() int { return s.messages }
+
+// Fields returns a summary per path, sorted by path.
+func (s *SchemaInferrer) Fields() []FieldSummary {
+	out := make([]FieldSummary, 0, len(s.fields))
+	for _, f := range s.fields {
+		c := *f
+		c.Optional = c.Messages < s.messages
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out
+}
+
+func (s *SchemaInferrer) value(r *MsgpReader, depth int) error {
+	if depth > maxDepth {
+		return ErrMaxDepth
+	}
+	t, n, _, err := r.Read()
+	if err == EOF && depth > 0 {
+		err = ErrTruncated
+	}
+	if err != nil {
+		return err
+	}
+	kind, ok := kindOf(t)
+	if !ok {
+		return ErrUnknownType
+	}
+
+	f := s.fields[string(s.path)]
+	if f == nil {
+		f = &FieldSummary{Path: string(s.path), Kinds: make(map[Kind]int)}
+		s.fields[f.Path] = f
+	}
+	if f.lastMsg != s.messages {
+		f.lastMsg = s.messages
+		f.Messages++
+	}
+	f.Count++
+	f.Kinds[kind]++
+
+	base := len(s.path)
+	switch kind {
+	case KindArray:
+		s.path = append(s.path, "[]"...)
+		for i := 0; i < n; i++ {
+			if err := s.value(r, depth+1); err != nil {
+				return err
+			}
+		}
+	case KindMap:
+		for i := 0; i < n; i++ {
+			start := r.Idx
+			kt, _, key, err := r.Read()
+			if err == nil && !kt.isStr() {
+				r.Idx = start
+				err = r.SkipValue()
+			}
+			if err == EOF {
+				err = ErrTruncated
+			}
+			if err != nil {
+				return err
+			}
+			s.path = append(s.path[:base], '.')
+			if kt.isStr() {
+				s.path = append(s.path, key...)
+			} else {
+				s.path = append(s.path, '*')
+			}
+			if err := s.value(r, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	s.path = s.path[:base]
+	return nil
+}
@@ -0,0 +1,92 @@
+package msgpraw
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaInferrer(t *testing.T) {
+	msg := func(withTags bool, id func(w *MsgpWriter) error) []byte {
+		w := &MsgpWriter{}
+		n := 1
+		if withTags {
+			n = 2
+		}
+		require.NoError(t, w.WriteMap(n))
+		require.NoError(t, w.WriteString("id"))
+		require.NoError(t, id(w))
+		if withTags {
+			require.NoError(t, w.WriteString("tags"))
+			require.NoError(t, w.WriteArray(2))
+			require.NoError(t, w.WriteString("a"))
+			require.NoError(t, w.WriteString("b"))
+		}
+		return w.Buff
+	}
+
+	var s SchemaInferrer
+	require.NoError(t, s.Add(msg(true, func(w *MsgpWriter) error { return w.WriteInt(1) })))
+	require.NoError(t, s.Add(msg(false, func(w *MsgpWriter) error { return w.WriteString("x") })))
+	assert.Equal(t, 2, s.Messages())
+
+	fields := s.Fields()
+	require.Len(t, fields, 4)
+	byPath := map[string]FieldSummary{}
+	for _, f := range fields {
+		byPath[f.Path] = f
+	}
+	assert.Equal(t, []string{"$", "$.id", "$.tags", "$.tags[]"},
+		[]string{fields[0].Path, fields[1].Path, fields[2].Path, fields[3].Path})
+
+	id := byPath["$.id"]
+	assert.Equal(t, 2, id.Messages)
+	assert.False(t, id.Optional)
+	assert.Equal(t, map[Kind]int{KindInt: 1, KindStr: 1}, id.Kinds)
+
+	tags := byPath["$.tags[]"]
+	assert.True(t, tags.Optional)
+	assert.Equal(t, 1, tags.Messages)
+	assert.Equal(t, 2, tags.Count)
+	assert.Equal(t, map[Kind]int{KindStr: 2}, tags.Kinds)
+}
+
+func TestSchemaInferrer_NonStringKeys(t *testing.T) {
+	w := &MsgpWriter{}
+	require.NoError(t, w.WriteMap(2))
+	require.NoError(t, w.WritePosFixInt(1))
+	require.NoError(t, w.WriteNil())
+	require.NoError(t, w.WriteArray(1)) // container key
+	require.NoError(t, w.WriteNil())
+	require.NoError(t, w.WriteBool(true))
+
+	var s SchemaInferrer
+	require.NoError(t, s.Add(w.Buff))
+	fields := s.Fields()
+	require.Len(t, fields, 2)
+	assert.Equal(t, "$.*", fields[1].Path)
+	assert.Equal(t, map[Kind]int{KindNil: 1, KindBool: 1}, fields[1].Kinds)
+}
+
+func TestSchemaInferrer_Errors(t *testing.T) {
+	var s SchemaInferrer
+	require.ErrorIs(t, s.Add([]byte{byte(FixMap) | 1, byte(Nil)}), ErrTruncated)
+	require.ErrorIs(t, s.Add([]byte{0xc1}), ErrUnknownType)
+}
+
+func TestSchemaInferrer_NoAllocsSteadyState(t *testing.T) {
+	w := &MsgpWriter{}
+	require.NoError(t, w.WriteMap(1))
+	require.NoError(t, w.WriteString("tags"))
+	require.NoError(t, w.WriteArray(3))
+	for i := 0; i < 3; i++ {
+		require.NoError(t, w.WriteInt(i))
+	}
+	var s SchemaInferrer
+	require.NoError(t, s.Add(w.Buff))
+	allocs := testing.AllocsPerRun(100, func() {
+		_ = s.Add(w.Buff)
+	})
+	require.Zero(t, allocs)
+}
@@ -0,0 +1,163 @@
+package msgpraw
+
+// ArrayIter iterates over the elements of an array. After each successful
+// Next the reader is positioned at the current element, so it can be read
+// with the usual methods or iterated further with ArrayIter/MapIter; any
+// part of the element left unread is skipped by the following Next.
+//
+//	it, err := r.ArrayIter()
+//	for it.Next() {
+//		t, _, data, err := it.Value()
+//		...
+//	}
+//	err = it.Err()
+type ArrayIter struct {
+	r    *MsgpReader
+	left int
+	cur  int // offset of the current element, -1 if there is none
+	err  error
+}
+
+// ArrayIter reads an array header and returns an iterator over its
+// elements. A value that is not an array is ErrTypeMismatch and leaves Idx
+// unchanged.
+func (r *MsgpReader) ArrayIter() (ArrayIter, error) {
+	n, err := r.openContainer(Type.isArray)
+	return ArrayIter{r: r, left: n, cur: -1}, err
+}
+
+// Next advances to the next element, skipping whatever the caller left
+// unread of the current one. It returns false at the end of the array, with
+// the reader positioned after it, or on error.
+func (it *ArrayIter) Next() bool {
+	if it.err != nil || it.r == nil {
+		return false
+	}
+	if it.cur >= 0 {
+		if it.err = it.r.skipFrom(it.cur); it.err != nil {
+			return false
+		}
+		it.cur = -1
+	}
+	if it.left == 0 {
+		return false
+	}
+	if it.r.Idx >= len(it.r.Buff) {
+		it.err = ErrTruncated
+		return false
+	}
+	it.left--
+	it.cur = it.r.Idx
+	return true
+}
+
+// Value reads the current element like Read, without moving the reader.
+func (it *ArrayIter) Value() (Type, int, []byte, error) {
+	return it.r.peekAt(it.cur)
+}
+
+// Remaining returns the number of elements after the current one.
+func (it *ArrayIter) Remaining() int { return it.left }
+
+// Err returns the error that stopped the iteration, if any.
+func (it *ArrayIter) Err() error { return it.err }
+
+// MapIter iterates over the key/value pairs of a map. After each successful
+// Next the reader is positioned at the current value; the key is available
+// through Key. Unread parts of the pair are skipped by the following Next.
+type MapIter struct {
+	r    *MsgpReader
+	left int
+	key  int // offset of the current key, -1 if there is none
+	val  int // offset of the current value
+	err  error
+}
+
+// MapIter reads a map header and returns an iterator over its pairs. A
+// value that is not a map is ErrTypeMismatch and leaves Idx unchanged.
+func (r *MsgpReader) MapIter() (MapIter, error) {
+	n, err := r.openContainer(Type.isMap)
+	return MapIter{r: r, left: n, key: -1}, err
+}
+
+// Next advances to the next pair, skipping whatever the caller left unread
+// of the current one. It returns false at the end of the map, with the
+// reader positioned after it, or on error.
+func (it *MapIter) Next() bool {
+	if it.err != nil || it.r == nil {
+		return false
+	}
+	if it.key >= 0 {
+		if it.err = it.r.skipFrom(it.val); it.err != nil {
+			return false
+		}
+		it.key = -1
+	}
+	if it.left == 0 {
+		return false
+	}
+	key := it.r.Idx
+	if it.err = it.r.skipFrom(key); it.err != nil {
+		return false
+	}
+	if it.r.Idx >= len(it.r.Buff) {
+		it.err = ErrTruncated
+		return false
+	}
+	it.left--
+	it.key, it.val = key, it.r.Idx
+	return true
+}
+
+// Key reads the current key like Read, without moving the reader.
+func (it *MapIter) Key() (Type, int, []byte, error) {
+	return it.r.peekAt(it.key)
+}
+
+// Value reads the current value like Read, without moving the reader.
+func (it *MapIter) Value() (Type, int, []byte, error) {
+	return it.r.peekAt(it.val)
+}
+
+// Remaining returns the number of pairs after the current one.
+func (it *MapIter) Remaining() int { return it.left }
+
+// Err returns the error that stopped the iteration, if any.
+func (it *MapIter) Err() error { return it.err }
+
+func (r *MsgpReader) openContainer(is func(Type) bool) (int, error) {
+	start := r.Idx
+	t, n, _, err := r.Read()
+	if err == nil && !is(t) {
+		err = ErrTypeMismatch
+	}
+	if err != nil {
+		r.Idx = start
+		return 0, err
+	}
+	return n, nil
+}
+
+// skipFrom moves the reader to the end of the value starting at off,
+// applying the reader's checks to any part of it not read yet.
+func (r *MsgpReader) skipFrom(off int) error {
+	r.Idx = off
+	err := r.SkipValue()
+	if err == EOF {
+		err = ErrTruncated
+	}
+	return err
+}
+
+// peekAt reads the value at off without moving the reader.
+func (r *MsgpReader) peekAt(off int) (Type, int, []byte, error) {
+	if off < 0 {
+		return 0, 0, nil, EOF
+	}
+	p := MsgpReader{Buff: r.Buff, Idx: off}
+	t, n, data, err := p.Read()
+	if err == nil && (r.Strict || r.ValidateUTF8) {
+		err = r.check(t, n, data)
+	}
+	return t, n, data, err
+}
@@ -0,0 +1,41 @@
+//go:build go1.23
+
+package msgpraw
+
+import "iter"
+
+// All returns a range-over-func sequence of the remaining elements, yielding
+// each element's tag and payload as Value would. The reader is positioned at
+// the element during the loop body. Check Err after the loop.
+func (it *ArrayIter) All() iter.Seq2[Type, []byte] {
+	return func(yield func(Type, []byte) bool) {
+		for it.Next() {
+			t, _, data, err := it.Value()
+			if err != nil {
+				it.err = err
+				return
+			}
+			if !yield(t, data) {
+				return
+			}
+		}
+	}
+}
+
+// All returns a range-over-func sequence of the remaining pairs, yielding
+// each key's tag and payload as Key would. The reader is positioned at the
+// pair's value during the loop body. Check Err after the loop.
+func (it *MapIter) All() iter.Seq2[Type, []byte] {
+	return func(yield func(Type, []byte) bool) {
+		for it.Next() {
+			t, _, data, err := it.Key()
+			if err != nil {
+				it.err = err
+				return
+			}
+			if !yield(t, data) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,64 @@
+//go:build go1.23
+
+package msgpraw
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIter_RangeOverFunc(t *testing.T) {
+	w := &MsgpWriter{}
+	require.NoError(t, w.WriteMap(2))
+	require.NoError(t, w.WriteString("a"))
+	require.NoError(t, w.WriteArray(3))
+	require.NoError(t, w.WritePosFixInt(1))
+	require.NoError(t, w.WritePosFixInt(2))
+	require.NoError(t, w.WritePosFixInt(3))
+	require.NoError(t, w.WriteString("b"))
+	require.NoError(t, w.WriteNil())
+
+	r := &MsgpReader{Buff: w.Buff}
+	m, err := r.MapIter()
+	require.NoError(t, err)
+	var keys []string
+	var sum int
+	for kt, key := range m.All() {
+		require.True(t, kt.isStr())
+		keys = append(keys, string(key))
+		if string(key) != "a" {
+			continue // value left unread
+		}
+		arr, err := r.ArrayIter()
+		require.NoError(t, err)
+		for vt := range arr.All() {
+			sum += int(vt)
+		}
+		require.NoError(t, arr.Err())
+	}
+	require.NoError(t, m.Err())
+	assert.Equal(t, []string{"a", "b"}, keys)
+	assert.Equal(t, 6, sum)
+	assert.Equal(t, len(w.Buff), r.Idx)
+}
+
+func TestIter_RangeBreak(t *testing.T) {
+	w := &MsgpWriter{}
+	require.NoError(t, w.WriteArray(3))
+	require.NoError(t, w.WriteNil())
+	require.NoError(t, w.WriteBool(true))
+	require.NoError(t, w.WriteNil())
+
+	r := &MsgpReader{Buff: w.Buff}
+	it, err := r.ArrayIter()
+	require.NoError(t, err)
+	for vt := range it.All() {
+		if vt == True {
+			break
+		}
+	}
+	assert.Equal(t, 2, r.Idx, "reader stays at the element the loop stopped on")
+	assert.Equal(t, 1, it.Remaining())
+}
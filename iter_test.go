@@ -0,0 +1,159 @@
+package msgpraw
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArrayIter(t *testing.T) {
+	w := &MsgpWriter{}
+	require.NoError(t, w.WriteArray(3))
+	require.NoError(t, w.WriteString("x"))
+	require.NoError(t, w.WriteArray(2)) // skipped without being read
+	require.NoError(t, w.WriteNil())
+	require.NoError(t, w.WriteNil())
+	require.NoError(t, w.WriteInt8(-5))
+	require.NoError(t, w.WriteBool(true)) // after the array
+
+	r := &MsgpReader{Buff: w.Buff}
+	it, err := r.ArrayIter()
+	require.NoError(t, err)
+
+	require.True(t, it.Next())
+	typ, _, data, err := it.Value()
+	require.NoError(t, err)
+	assert.True(t, typ.isStr())
+	assert.Equal(t, "x", string(data))
+	assert.Equal(t, 2, it.Remaining())
+
+	require.True(t, it.Next())
+	typ, n, _, err := it.Value()
+	require.NoError(t, err)
+	assert.Equal(t, byte(FixArray)|2, byte(typ))
+	assert.Equal(t, 2, n)
+
+	require.True(t, it.Next())
+	_, _, data, err = r.Read() // consume through the reader
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0xfb}, data)
+
+	require.False(t, it.Next())
+	require.NoError(t, it.Err())
+	require.False(t, it.Next(), "Next stays false")
+
+	typ, _, _, err = r.Read()
+	require.NoError(t, err)
+	assert.Equal(t, True, typ)
+}
+
+func TestArrayIter_PartiallyConsumedChild(t *testing.T) {
+	w := &MsgpWriter{}
+	require.NoError(t, w.WriteArray(2))
+	require.NoError(t, w.WriteMap(2))
+	require.NoError(t, w.WriteString("a"))
+	require.NoError(t, w.WriteNil())
+	require.NoError(t, w.WriteString("b"))
+	require.NoError(t, w.WriteNil())
+	require.NoError(t, w.WritePosFixInt(9))
+
+	r := &MsgpReader{Buff: w.Buff}
+	it, err := r.ArrayIter()
+	require.NoError(t, err)
+	require.True(t, it.Next())
+	m, err := r.MapIter()
+	require.NoError(t, err)
+	require.True(t, m.Next()) // stop after the first pair
+
+	require.True(t, it.Next())
+	typ, _, _, err := it.Value()
+	require.NoError(t, err)
+	assert.Equal(t, Type(9), typ)
+	require.False(t, it.Next())
+	assert.Equal(t, len(w.Buff), r.Idx)
+}
+
+func TestMapIter(t *testing.T) {
+	w := &MsgpWriter{}
+	require.NoError(t, w.WriteMap(2))
+	require.NoError(t, w.WritePosFixInt(1))
+	require.NoError(t, w.WriteString("one"))
+	require.NoError(t, w.WriteString("k"))
+	require.NoError(t, w.WriteArray(1))
+	require.NoError(t, w.WriteNil())
+
+	r := &MsgpReader{Buff: w.Buff}
+	it, err := r.MapIter()
+	require.NoError(t, err)
+
+	require.True(t, it.Next())
+	kt, _, _, err := it.Key()
+	require.NoError(t, err)
+	assert.Equal(t, Type(1), kt)
+	_, _, v, err := it.Value()
+	require.NoError(t, err)
+	assert.Equal(t, "one", string(v))
+	assert.Equal(t, 2, r.Idx, "reader is positioned at the value")
+
+	require.True(t, it.Next())
+	_, _, k, err := it.Key()
+	require.NoError(t, err)
+	assert.Equal(t, "k", string(k))
+
+	require.False(t, it.Next())
+	require.NoError(t, it.Err())
+	assert.Equal(t, len(w.Buff), r.Idx)
+}
+
+func TestIter_Errors(t *testing.T) {
+	r := &MsgpReader{Buff: []byte{byte(Nil)}}
+	_, err := r.ArrayIter()
+	require.ErrorIs(t, err, ErrTypeMismatch)
+	_, err = r.MapIter()
+	require.ErrorIs(t, err, ErrTypeMismatch)
+	assert.Equal(t, 0, r.Idx)
+
+	r = &MsgpReader{Buff: []byte{byte(FixArray) | 2, byte(Nil)}}
+	it, err := r.ArrayIter()
+	require.NoError(t, err)
+	require.True(t, it.Next())
+	require.False(t, it.Next())
+	require.ErrorIs(t, it.Err(), ErrTruncated)
+
+	r = &MsgpReader{Buff: []byte{byte(FixMap) | 1, byte(Nil)}}
+	m, err := r.MapIter()
+	require.NoError(t, err)
+	require.False(t, m.Next())
+	require.ErrorIs(t, m.Err(), ErrTruncated)
+
+	// Skipped subtrees are still checked by a strict reader.
+	w := &MsgpWriter{}
+	require.NoError(t, w.WriteArray(2))
+	require.NoError(t, w.WriteInt64(1))
+	require.NoError(t, w.WriteNil())
+	r = &MsgpReader{Buff: w.Buff, Strict: true}
+	it, err = r.ArrayIter()
+	require.NoError(t, err)
+	require.True(t, it.Next())
+	require.False(t, it.Next())
+	require.ErrorIs(t, it.Err(), ErrNonCanonicalInt)
+}
+
+func TestIter_NoAllocs(t *testing.T) {
+	buf := allTagsFixture(t)
+	w := &MsgpWriter{}
+	require.NoError(t, w.WriteArray(2))
+	require.NoError(t, w.WriteMap(1))
+	require.NoError(t, w.WriteString("a"))
+	require.NoError(t, w.WriteBytes(buf[:8]))
+	require.NoError(t, w.WriteNil())
+	allocs := testing.AllocsPerRun(100, func() {
+		r := MsgpReader{Buff: w.Buff}
+		it, _ := r.ArrayIter()
+		for it.Next() {
+			_, _, _, _ = it.Value()
+		}
+	})
+	require.Zero(t, allocs)
+}
@@ -0,0 +1,61 @@
+package msgpraw
+
+// FindKey looks up a string key in the map at the reader's position. On
+// success the reader is positioned at the value stored under key; when a key
+// appears more than once the first pair wins. Keys are compared without
+// converting them to strings, and values of other pairs are skipped whole.
+//
+// A value that is not a map is ErrTypeMismatch and a missing key ErrNotFound;
+// on any error Idx is left at the map.
+func (r *MsgpReader) FindKey(key string) error {
+	_, err := r.findKey(func(t Type, data []byte) bool { return t.isStr() && string(data) == key })
+	return err
+}
+
+// FindIntKey is FindKey for an integer key. A key matches whatever integer
+// format encodes it: PosFixInt 5, Uint8 5 and Int64 5 are all key 5.
+func (r *MsgpReader) FindIntKey(key int64) error {
+	_, err := r.findKey(func(t Type, data []byte) bool { return isIntKey(t, data, key) })
+	return err
+}
+
+// isIntKey reports whether the value with tag t and payload data is an
+// integer equal to key.
+func isIntKey(t Type, data []byte, key int64) bool {
+	v, isUint, ok := intPayload(t, data)
+	// A Uint64 above math.MaxInt64 comes back negative; it equals no int64.
+	return ok && v == key && (!isUint || v >= 0)
+}
+
+// findKey implements FindKey for any key predicate. It also returns the
+// offset of the matching key.
+func (r *MsgpReader) findKey(match func(Type, []byte) bool) (int, error) {
+	start := r.Idx
+	n, err := r.openContainer(Type.isMap)
+	if err != nil {
+		return 0, err
+	}
+	for i := 0; i < n; i++ {
+		keyStart := r.Idx
+		t, _, data, err := r.Read()
+		if err == nil && match(t, data) {
+			return keyStart, nil
+		}
+		if err == nil && (t.isArray() || t.isMap()) {
+			// A container key is skipped together with its children.
+			err = r.skipFrom(keyStart)
+		}
+		if err == nil {
+			err = r.SkipValue()
+		}
+		if err == EOF {
+			err = ErrTruncated
+		}
+		if err != nil {
+			r.Idx = start
+			return 0, err
+		}
+	}
+	r.Idx = start
+	return 0, ErrNotFound
+}
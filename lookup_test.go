@@ -0,0 +1,124 @@
+package msgpraw
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func lookupFixture(t *testing.T) []byte {
+	w := &MsgpWriter{}
+	require.NoError(t, w.WriteMap(5))
+	// A container key and value that must be skipped whole.
+	require.NoError(t, w.WriteArray(1))
+	require.NoError(t, w.WriteString("status"))
+	require.NoError(t, w.WriteMap(1))
+	require.NoError(t, w.WriteString("status"))
+	require.NoError(t, w.WriteInt(-1))
+	require.NoError(t, w.WriteInt(5))
+	require.NoError(t, w.WriteString("five"))
+	require.NoError(t, w.WriteString("id"))
+	require.NoError(t, w.WritePosFixInt(42))
+	require.NoError(t, w.WriteString("status"))
+	require.NoError(t, w.WriteString("ok"))
+	require.NoError(t, w.WriteString("status"))
+	require.NoError(t, w.WriteString("duplicate"))
+	require.NoError(t, w.WriteNil())
+	return w.Buff
+}
+
+func TestFindKey(t *testing.T) {
+	buf := lookupFixture(t)
+	r := &MsgpReader{Buff: buf}
+	require.NoError(t, r.FindKey("status"))
+	typ, _, data, err := r.Read()
+	require.NoError(t, err)
+	assert.True(t, typ.isStr())
+	assert.Equal(t, "ok", string(data))
+
+	r = &MsgpReader{Buff: buf}
+	require.NoError(t, r.FindKey("id"))
+	typ, _, _, err = r.Read()
+	require.NoError(t, err)
+	assert.Equal(t, Type(42), typ)
+}
+
+func TestFindKey_Errors(t *testing.T) {
+	buf := lookupFixture(t)
+	r := &MsgpReader{Buff: buf}
+	require.ErrorIs(t, r.FindKey("missing"), ErrNotFound)
+	assert.Zero(t, r.Idx)
+
+	r = &MsgpReader{Buff: []byte{byte(FixArray) | 1, 0x01}}
+	require.ErrorIs(t, r.FindKey("a"), ErrTypeMismatch)
+	assert.Zero(t, r.Idx)
+
+	// Truncated inside a value that must be skipped.
+	r = &MsgpReader{Buff: []byte{byte(FixMap) | 2, 0xa1, 'x', byte(FixArray) | 2, 0x01}}
+	require.ErrorIs(t, r.FindKey("a"), ErrTruncated)
+	assert.Zero(t, r.Idx)
+
+	r = &MsgpReader{Buff: []byte{byte(FixMap) | 2, 0xa1, 'x', 0x01}}
+	require.ErrorIs(t, r.FindKey("a"), ErrTruncated)
+	assert.Zero(t, r.Idx)
+}
+
+func TestFindKey_NoAllocs(t *testing.T) {
+	buf := lookupFixture(t)
+	allocs := testing.AllocsPerRun(100, func() {
+		r := MsgpReader{Buff: buf}
+		_ = r.FindKey("status")
+	})
+	require.Zero(t, allocs)
+}
+
+// compactKeysFixture is a map keyed by integers in assorted formats, with a
+// string key mixed in.
+func compactKeysFixture(t *testing.T) []byte {
+	w := &MsgpWriter{}
+	require.NoError(t, w.WriteMap(6))
+	require.NoError(t, w.WriteUint64(1<<63)) // above math.MaxInt64
+	require.NoError(t, w.WriteString("huge"))
+	require.NoError(t, w.WriteUint8(5))
+	require.NoError(t, w.WriteString("five"))
+	require.NoError(t, w.WritePosFixInt(5))
+	require.NoError(t, w.WriteString("duplicate"))
+	require.NoError(t, w.WriteString("name"))
+	require.NoError(t, w.WriteString("n"))
+	require.NoError(t, w.WriteInt64(-2))
+	require.NoError(t, w.WriteString("minus two"))
+	require.NoError(t, w.WriteInt16(300))
+	require.NoError(t, w.WriteString("three hundred"))
+	return w.Buff
+}
+
+func TestFindIntKey(t *testing.T) {
+	buf := compactKeysFixture(t)
+	for key, want := range map[int64]string{5: "five", -2: "minus two", 300: "three hundred"} {
+		r := &MsgpReader{Buff: buf}
+		require.NoError(t, r.FindIntKey(key))
+		_, _, data, err := r.Read()
+		require.NoError(t, err)
+		assert.Equal(t, want, string(data))
+	}
+
+	r := &MsgpReader{Buff: buf}
+	require.ErrorIs(t, r.FindIntKey(-1<<63), ErrNotFound, "Uint64 1<<63 is not int64 -1<<63")
+	require.ErrorIs(t, r.FindIntKey(7), ErrNotFound)
+	assert.Zero(t, r.Idx)
+
+	require.NoError(t, r.FindKey("name"))
+	_, _, data, err := r.Read()
+	require.NoError(t, err)
+	assert.Equal(t, "n", string(data))
+}
+
+func TestFindIntKey_NoAllocs(t *testing.T) {
+	buf := compactKeysFixture(t)
+	allocs := testing.AllocsPerRun(100, func() {
+		r := MsgpReader{Buff: buf}
+		_ = r.FindIntKey(300)
+	})
+	require.Zero(t, allocs)
+}
@@ -0,0 +1,411 @@
+package msgpraw
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strconv"
+)
+
+// ChangeKind says how a value differs between two documents.
+type ChangeKind uint8
+
+const (
+	Added ChangeKind = iota + 1
+	Removed
+	Changed
+)
+
+var changeKindNames = [...]string{Added: "added", Removed: "removed", Changed: "changed"}
+
+func (k ChangeKind) String() string {
+	if int(k) < len(changeKindNames) && changeKindNames[k] != "" {
+		return changeKindNames[k]
+	}
+	return "ChangeKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// Change is one difference reported by Diff. Path is an encoded array of
+// steps as taken by Replace, Delete and Insert, so a change can be applied
+// to another document directly. Old and New are the raw values, sub-slices
+// of Diff's inputs; Old is nil for Added and New is nil for Removed.
+type Change struct {
+	Kind ChangeKind
+	Path []byte
+	Old  []byte
+	New  []byte
+}
+
+// Diff lists the changes that turn the value a into the value b. Maps are
+// compared key by key and arrays element by element; extra elements at the
+// end of an array are Added or Removed. Any other pair of values, including
+// two containers of different kinds, is compared by meaning: integers and
+// floats by numeric value whatever their format, strings and binaries by
+// payload. A map whose keys are not all strings and integers is compared as
+// a whole.
+//
+// a and b must each hold exactly one value. When a key appears more than
+// once in a map the first pair wins. Changes are listed in the order of a,
+// followed by the additions in the order of b.
+func Diff(a, b []byte) ([]Change, error) {
+	if err := checkSingleValue(a); err != nil {
+		return nil, err
+	}
+	if err := checkSingleValue(b); err != nil {
+		return nil, err
+	}
+	d := differ{}
+	if err := d.value(a, b, 0); err != nil {
+		return nil, err
+	}
+	return d.changes, nil
+}
+
+type differ struct {
+	steps   [][]byte // encoded path steps down to the current value
+	changes []Change
+}
+
+func (d *differ) add(kind ChangeKind, old, new []byte) {
+	w := MsgpWriter{}
+	_ = w.WriteArray(len(d.steps))
+	for _, s := range d.steps {
+		w.Buff = append(w.Buff, s...)
+	}
+	d.changes = append(d.changes, Change{Kind: kind, Path: w.Buff, Old: old, New: new})
+}
+
+// value compares the single values a and b.
+func (d *differ) value(a, b []byte, depth int) error {
+	if depth > maxDepth {
+		return ErrMaxDepth
+	}
+	if bytes.Equal(a, b) {
+		return nil
+	}
+	ra, rb := MsgpReader{Buff: a}, MsgpReader{Buff: b}
+	ta, na, _, _ := ra.Read()
+	tb, nb, _, _ := rb.Read()
+
+	switch {
+	case ta.isMap() && tb.isMap():
+		pa, _, err := mapPairs(a)
+		if err != nil {
+			return err
+		}
+		pb, _, err := mapPairs(b)
+		if err != nil {
+			return err
+		}
+		if simpleKeys(pa) && simpleKeys(pb) {
+			return d.maps(pa, pb, depth)
+		}
+	case ta.isArray() && tb.isArray():
+		common := na
+		if nb < common {
+			common = nb
+		}
+		for i := 0; i < na || i < nb; i++ {
+			var ea, eb []byte
+			var err error
+			if i < na {
+				if ea, err = nextValue(&ra); err != nil {
+					return err
+				}
+			}
+			if i < nb {
+				if eb, err = nextValue(&rb); err != nil {
+					return err
+				}
+			}
+			w := MsgpWriter{}
+			_ = w.writeIntCompact(int64(i))
+			d.steps = append(d.steps, w.Buff)
+			switch {
+			case i < common:
+				err = d.value(ea, eb, depth+1)
+			case i < na:
+				d.add(Removed, ea, nil)
+			default:
+				d.add(Added, nil, eb)
+			}
+			d.steps = d.steps[:len(d.steps)-1]
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if !equalValues(a, b) {
+		d.add(Changed, a, b)
+	}
+	return nil
+}
+
+func (d *differ) maps(pa, pb []rawPair, depth int) error {
+	ka, kb := indexKeys(pa), indexKeys(pb)
+	for i, p := range pa {
+		if !ka.first(i) {
+			continue
+		}
+		d.steps = append(d.steps, p.key)
+		var err error
+		if j, ok := kb.index[ka.ids[i]]; ok {
+			err = d.value(p.val, pb[j].val, depth+1)
+		} else {
+			d.add(Removed, p.val, nil)
+		}
+		d.steps = d.steps[:len(d.steps)-1]
+		if err != nil {
+			return err
+		}
+	}
+	for i, p := range pb {
+		if _, ok := ka.index[kb.ids[i]]; ok || !kb.first(i) {
+			continue
+		}
+		d.steps = append(d.steps, p.key)
+		d.add(Added, nil, p.val)
+		d.steps = d.steps[:len(d.steps)-1]
+	}
+	return nil
+}
+
+// Merge applies patch to base following JSON Merge Patch (RFC 7386) and
+// returns the result as a new buffer. A patch that is a map is merged key by
+// key: a nil value removes the key from base, any other value is merged into
+// base's value for that key, recursively. A patch of any other kind replaces
+// base outright. A base that is not a map is treated as an empty one when
+// the patch is a map; base may also be empty.
+//
+// Keys match like in Diff and pairs of base that the patch doesn't touch are
+// copied verbatim, in their original order, followed by the keys the patch
+// adds. patch must hold exactly one value.
+func Merge(base, patch []byte) ([]byte, error) {
+	if len(base) > 0 {
+		if err := checkSingleValue(base); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkSingleValue(patch); err != nil {
+		return nil, err
+	}
+	w := &MsgpWriter{Buff: make([]byte, 0, len(base)+len(patch))}
+	if err := mergeValue(w, base, patch, 0); err != nil {
+		return nil, err
+	}
+	return w.Buff, nil
+}
+
+func mergeValue(w *MsgpWriter, base, patch []byte, depth int) error {
+	if depth > maxDepth {
+		return ErrMaxDepth
+	}
+	pp, isMap, err := mapPairs(patch)
+	if err != nil {
+		return err
+	}
+	if !isMap {
+		w.Buff = append(w.Buff, patch...)
+		return nil
+	}
+	bp, _, err := mapPairs(base)
+	if err != nil {
+		return err
+	}
+
+	kb, kp := indexKeys(bp), indexKeys(pp)
+
+	// Count the result's pairs first so the header can be written up front.
+	n := 0
+	for i := range bp {
+		if j, ok := kp.index[kb.ids[i]]; !ok {
+			n++
+		} else if kb.first(i) && !isNil(pp[j].val) {
+			n++
+		}
+	}
+	for i, p := range pp {
+		if _, ok := kb.index[kp.ids[i]]; !ok && kp.first(i) && !isNil(p.val) {
+			n++
+		}
+	}
+	if err := w.WriteMap(n); err != nil {
+		return err
+	}
+
+	for i, p := range bp {
+		j, ok := kp.index[kb.ids[i]]
+		if !ok {
+			w.Buff = append(w.Buff, p.key...)
+			w.Buff = append(w.Buff, p.val...)
+			continue
+		}
+		// Later duplicates of a patched key are dropped.
+		if !kb.first(i) || isNil(pp[j].val) {
+			continue
+		}
+		w.Buff = append(w.Buff, p.key...)
+		if err := mergeValue(w, p.val, pp[j].val, depth+1); err != nil {
+			return err
+		}
+	}
+	for i, p := range pp {
+		if _, ok := kb.index[kp.ids[i]]; ok || !kp.first(i) || isNil(p.val) {
+			continue
+		}
+		w.Buff = append(w.Buff, p.key...)
+		if err := mergeValue(w, nil, p.val, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rawPair is one key/value pair of a map, both as encoded bytes.
+type rawPair struct{ key, val []byte }
+
+// mapPairs splits the map v into its pairs. isMap is false, with no error,
+// when v is not a map.
+func mapPairs(v []byte) (pairs []rawPair, isMap bool, err error) {
+	r := MsgpReader{Buff: v}
+	t, n, _, err := r.Read()
+	if err != nil || !t.isMap() {
+		return nil, false, nil
+	}
+	if 2*n > len(v)-r.Idx {
+		return nil, false, ErrTruncated
+	}
+	pairs = make([]rawPair, n)
+	for i := range pairs {
+		if pairs[i].key, err = nextValue(&r); err != nil {
+			return nil, false, err
+		}
+		if pairs[i].val, err = nextValue(&r); err != nil {
+			return nil, false, err
+		}
+	}
+	return pairs, true, nil
+}
+
+// simpleKeys reports whether every key is a string or an integer, the only
+// keys a path step can name.
+func simpleKeys(pairs []rawPair) bool {
+	for _, p := range pairs {
+		if t := Type(p.key[0]); !t.isStr() && !isIntType(t) {
+			return false
+		}
+	}
+	return true
+}
+
+// nextValue returns the encoding of the next value and moves r past it.
+func nextValue(r *MsgpReader) ([]byte, error) {
+	start := r.Idx
+	if err := r.skipFrom(start); err != nil {
+		return nil, err
+	}
+	return r.Buff[start:r.Idx], nil
+}
+
+// keyIndex finds the pairs of a map by key. Keys are normalized by keyID,
+// so that two keys are equal exactly when equalValues says so.
+type keyIndex struct {
+	ids   []string       // the key of each pair
+	index map[string]int // the first pair holding each key
+}
+
+func indexKeys(pairs []rawPair) keyIndex {
+	k := keyIndex{ids: make([]string, len(pairs)), index: make(map[string]int, len(pairs))}
+	for i, p := range pairs {
+		id := keyID(p.key)
+		k.ids[i] = id
+		if _, dup := k.index[id]; !dup {
+			k.index[id] = i
+		}
+	}
+	return k
+}
+
+// first reports whether pair i holds the first occurrence of its key.
+func (k keyIndex) first(i int) bool { return k.index[k.ids[i]] == i }
+
+// keyID returns a string that is the same for two encoded values exactly
+// when equalValues reports them equal: integers by value and sign, floats by
+// value, strings, binaries and exts by payload, anything else byte for byte.
+func keyID(v []byte) string {
+	r := MsgpReader{Buff: v}
+	t, _, data, err := r.Read()
+	if err != nil {
+		return "r" + string(v)
+	}
+	k, _ := kindOf(t)
+	var b [9]byte
+	switch {
+	case isIntType(t):
+		i, isUint, _ := intPayload(t, data)
+		b[0] = 'i'
+		if isUint && i < 0 {
+			b[0] = 'u' // above math.MaxInt64
+		}
+		binary.BigEndian.PutUint64(b[1:], uint64(i))
+		return string(b[:])
+	case k == KindFloat:
+		f, _ := floatPayload(t, data)
+		switch {
+		case f != f:
+			f = math.NaN()
+		case f == 0:
+			f = 0
+		}
+		b[0] = 'f'
+		binary.BigEndian.PutUint64(b[1:], math.Float64bits(f))
+		return string(b[:])
+	case k == KindStr:
+		return "s" + string(data)
+	case k == KindBin:
+		return "b" + string(data)
+	case k == KindExt:
+		return "e" + string(data)
+	}
+	return "r" + string(v)
+}
+
+func isIntType(t Type) bool {
+	k, _ := kindOf(t)
+	return k == KindInt || k == KindUint
+}
+
+func isNil(v []byte) bool { return len(v) == 1 && Type(v[0]) == Nil }
+
+// equalValues reports whether the encoded values a and b mean the same:
+// numbers compare by value, strings, binaries and exts by payload, and
+// containers byte for byte.
+func equalValues(a, b []byte) bool {
+	if bytes.Equal(a, b) {
+		return true
+	}
+	ra, rb := MsgpReader{Buff: a}, MsgpReader{Buff: b}
+	ta, _, da, errA := ra.Read()
+	tb, _, db, errB := rb.Read()
+	if errA != nil || errB != nil {
+		return false
+	}
+	ka, _ := kindOf(ta)
+	kb, _ := kindOf(tb)
+	switch {
+	case isIntType(ta) && isIntType(tb):
+		va, uA, _ := intPayload(ta, da)
+		vb, uB, _ := intPayload(tb, db)
+		return va == vb && (uA == uB || va >= 0)
+	case ka == KindFloat && kb == KindFloat:
+		fa, _ := floatPayload(ta, da)
+		fb, _ := floatPayload(tb, db)
+		return fa == fb || (fa != fa && fb != fb)
+	case ka != kb:
+		return false
+	case ka == KindStr, ka == KindBin, ka == KindExt:
+		return bytes.Equal(da, db)
+	}
+	return false
+}
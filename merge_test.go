@@ -0,0 +1,232 @@
+package msgpraw
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	a := encodeValue(t, mustMap(t,
+		StrValue("name"), StrValue("svc"),
+		StrValue("port"), IntValue(80),
+		StrValue("tags"), ArrayValue(StrValue("a"), StrValue("b"), StrValue("c")),
+		StrValue("tls"), mustMap(t, StrValue("on"), BoolValue(false)),
+		IntValue(1), StrValue("gone"),
+	))
+	b := encodeValue(t, mustMap(t,
+		StrValue("tls"), mustMap(t, StrValue("on"), BoolValue(true), StrValue("cert"), StrValue("x")),
+		StrValue("port"), UintValue(80), // same number, different format
+		StrValue("name"), StrValue("svc2"),
+		StrValue("tags"), ArrayValue(StrValue("a"), StrValue("B")),
+		StrValue("new"), NilValue(),
+	))
+
+	changes, err := Diff(a, b)
+	require.NoError(t, err)
+	type change struct {
+		kind     ChangeKind
+		path     []byte
+		old, new []byte
+	}
+	var got []change
+	for _, c := range changes {
+		got = append(got, change{c.Kind, c.Path, c.Old, c.New})
+	}
+	str := func(s string) []byte { return encodeValue(t, StrValue(s)) }
+	assert.Equal(t, []change{
+		{Changed, encodePath(t, "name"), str("svc"), str("svc2")},
+		{Changed, encodePath(t, "tags", 1), str("b"), str("B")},
+		{Removed, encodePath(t, "tags", 2), str("c"), nil},
+		{Changed, encodePath(t, "tls", "on"), []byte{0xc2}, []byte{0xc3}},
+		{Added, encodePath(t, "tls", "cert"), nil, str("x")},
+		{Removed, encodePath(t, 1), str("gone"), nil},
+		{Added, encodePath(t, "new"), nil, []byte{0xc0}},
+	}, got)
+	assert.Equal(t, "changed", changes[0].Kind.String())
+
+	changes, err = Diff(a, a)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+func TestDiff_Scalars(t *testing.T) {
+	for name, tc := range map[string]struct {
+		a, b  Value
+		equal bool
+	}{
+		"int formats":      {IntValue(5), UintValue(5), true},
+		"float formats":    {Float32Value(1.5), Float64Value(1.5), true},
+		"int vs float":     {IntValue(1), Float64Value(1), false},
+		"huge uint vs neg": {UintValue(1 << 63), IntValue(-1 << 63), false},
+		"str vs bin":       {StrValue("a"), BinValue([]byte("a")), false},
+		"array vs map":     {ArrayValue(), mustMap(t), false},
+	} {
+		changes, err := Diff(encodeValue(t, tc.a), encodeValue(t, tc.b))
+		require.NoError(t, err)
+		if tc.equal {
+			assert.Empty(t, changes, name)
+		} else {
+			require.Len(t, changes, 1, name)
+			assert.Equal(t, Changed, changes[0].Kind, name)
+			assert.Equal(t, []byte{byte(FixArray)}, changes[0].Path, name)
+		}
+	}
+
+	// A long str encoding of "a" equals the FixStr one.
+	changes, err := Diff([]byte{0xa1, 'a'}, []byte{byte(Str8), 1, 'a'})
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+
+	_, err = Diff([]byte{0xc0, 0xc0}, []byte{0xc0})
+	assert.ErrorIs(t, err, ErrInvalidValue)
+}
+
+func TestDiff_AppliesWithPatch(t *testing.T) {
+	a := encodeValue(t, mustMap(t,
+		StrValue("a"), IntValue(1),
+		StrValue("b"), mustMap(t, StrValue("c"), IntValue(2)),
+	))
+	b := encodeValue(t, mustMap(t,
+		StrValue("a"), IntValue(10),
+		StrValue("b"), mustMap(t, StrValue("d"), IntValue(3)),
+	))
+	changes, err := Diff(a, b)
+	require.NoError(t, err)
+	out := a
+	for _, c := range changes {
+		switch c.Kind {
+		case Changed:
+			out, err = Replace(out, c.Path, c.New)
+		case Removed:
+			out, err = Delete(out, c.Path)
+		case Added:
+			out, err = Insert(out, c.Path, c.New)
+		}
+		require.NoError(t, err)
+	}
+	changes, err = Diff(out, b)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+// TestMerge follows the examples of RFC 7386, appendix A.
+func TestMerge(t *testing.T) {
+	s := StrValue
+	for i, tc := range []struct{ base, patch, want Value }{
+		{mustMap(t, s("a"), s("b")), mustMap(t, s("a"), s("c")), mustMap(t, s("a"), s("c"))},
+		{mustMap(t, s("a"), s("b")), mustMap(t, s("b"), s("c")), mustMap(t, s("a"), s("b"), s("b"), s("c"))},
+		{mustMap(t, s("a"), s("b")), mustMap(t, s("a"), NilValue()), mustMap(t)},
+		{mustMap(t, s("a"), s("b"), s("b"), s("c")), mustMap(t, s("a"), NilValue()), mustMap(t, s("b"), s("c"))},
+		{mustMap(t, s("a"), ArrayValue(s("b"))), mustMap(t, s("a"), s("c")), mustMap(t, s("a"), s("c"))},
+		{mustMap(t, s("a"), s("c")), mustMap(t, s("a"), ArrayValue(s("b"))), mustMap(t, s("a"), ArrayValue(s("b")))},
+		{
+			mustMap(t, s("a"), mustMap(t, s("b"), s("c"))),
+			mustMap(t, s("a"), mustMap(t, s("b"), s("d"), s("c"), NilValue())),
+			mustMap(t, s("a"), mustMap(t, s("b"), s("d"))),
+		},
+		{mustMap(t, s("a"), ArrayValue(mustMap(t, s("b"), s("c")))), mustMap(t, s("a"), ArrayValue(IntValue(1))), mustMap(t, s("a"), ArrayValue(IntValue(1)))},
+		{ArrayValue(s("a"), s("b")), ArrayValue(s("c"), s("d")), ArrayValue(s("c"), s("d"))},
+		{mustMap(t, s("a"), s("b")), ArrayValue(s("c")), ArrayValue(s("c"))},
+		{mustMap(t, s("a"), s("foo")), NilValue(), NilValue()},
+		{mustMap(t, s("a"), s("foo")), s("bar"), s("bar")},
+		{mustMap(t, s("e"), NilValue()), mustMap(t, s("a"), IntValue(1)), mustMap(t, s("e"), NilValue(), s("a"), IntValue(1))},
+		{ArrayValue(IntValue(1), IntValue(2)), mustMap(t, s("a"), s("b"), s("c"), NilValue()), mustMap(t, s("a"), s("b"))},
+		{
+			mustMap(t),
+			mustMap(t, s("a"), mustMap(t, s("bb"), mustMap(t, s("ccc"), NilValue()))),
+			mustMap(t, s("a"), mustMap(t, s("bb"), mustMap(t))),
+		},
+	} {
+		out, err := Merge(encodeValue(t, tc.base), encodeValue(t, tc.patch))
+		require.NoError(t, err, "case %d", i)
+		assert.Equal(t, encodeValue(t, tc.want), out, "case %d", i)
+	}
+}
+
+func TestMerge_Keys(t *testing.T) {
+	// Integer keys match whatever their format; untouched pairs are copied
+	// verbatim, including their original encoding.
+	base := []byte{0x82, byte(Uint8), 5, 0xa1, 'x', byte(Int64), 0, 0, 0, 0, 0, 0, 0, 6, 0xa1, 'y'}
+	patch := []byte{0x81, 0x05, 0xc0}
+	out, err := Merge(base, patch)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x81, byte(Int64), 0, 0, 0, 0, 0, 0, 0, 6, 0xa1, 'y'}, out)
+
+	out, err = Merge(nil, encodeValue(t, mustMap(t, StrValue("a"), NilValue(), StrValue("b"), IntValue(1))))
+	require.NoError(t, err)
+	assert.Equal(t, encodeValue(t, mustMap(t, StrValue("b"), IntValue(1))), out)
+
+	_, err = Merge([]byte{0x81}, patch)
+	assert.ErrorIs(t, err, ErrInvalidValue)
+	_, err = Merge(base, nil)
+	assert.ErrorIs(t, err, ErrInvalidValue)
+}
+
+func TestMerge_OtherKeys(t *testing.T) {
+	// A patch keyed by a binary is still merged key by key.
+	base := encodeValue(t, mustMap(t, BinValue([]byte{1}), IntValue(1), StrValue("a"), IntValue(2)))
+	patch := encodeValue(t, mustMap(t, BinValue([]byte{1}), NilValue()))
+	out, err := Merge(base, patch)
+	require.NoError(t, err)
+	assert.Equal(t, encodeValue(t, mustMap(t, StrValue("a"), IntValue(2))), out)
+
+	// Diff compares such maps as a whole.
+	changes, err := Diff(base, out)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, Changed, changes[0].Kind)
+}
+
+func TestKeyID_MatchesEqualValues(t *testing.T) {
+	keys := [][]byte{
+		{0x05}, {byte(Uint8), 5}, {byte(Int64), 0, 0, 0, 0, 0, 0, 0, 5},
+		{0xff}, {byte(Int8), 0xff},
+		{byte(Uint64), 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		{byte(Int64), 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		encodeValue(t, Float32Value(1.5)), encodeValue(t, Float64Value(1.5)),
+		encodeValue(t, Float64Value(0)), {byte(Float64), 0x80, 0, 0, 0, 0, 0, 0, 0},
+		{byte(Float32), 0x7f, 0xc0, 0, 0}, {byte(Float64), 0x7f, 0xf8, 0, 0, 0, 0, 0, 1},
+		{0xa1, 'a'}, {byte(Str8), 1, 'a'}, {0xc4, 1, 'a'}, {byte(FixExt1), 1, 'a'},
+		{byte(Nil)}, {byte(True)}, {0x91, 0x01}, {0x91, byte(Uint8), 1},
+	}
+	for _, a := range keys {
+		for _, b := range keys {
+			assert.Equal(t, equalValues(a, b), keyID(a) == keyID(b), "%x %x", a, b)
+		}
+	}
+}
+
+func TestDiff_LargeMaps(t *testing.T) {
+	const n = 20000
+	build := func(changed int) []byte {
+		w := &MsgpWriter{}
+		require.NoError(t, w.WriteMap(n))
+		for i := 0; i < n; i++ {
+			require.NoError(t, w.WriteInt(i))
+			v := i
+			if i == changed {
+				v = -1
+			}
+			require.NoError(t, w.WriteInt(v))
+		}
+		return w.Buff
+	}
+	a, b := build(-1), build(n/2)
+
+	// Quadratic key matching would take seconds here.
+	start := time.Now()
+	changes, err := Diff(a, b)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	patched, err := Replace(a, changes[0].Path, changes[0].New)
+	require.NoError(t, err)
+	assert.Equal(t, b, patched)
+
+	out, err := Merge(a, b)
+	require.NoError(t, err)
+	assert.Equal(t, b, out)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
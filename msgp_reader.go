@@ -32,6 +32,15 @@ type IMsgpReader interface {
 type MsgpReader struct {
 	Buff []byte
 	Idx  int
+	// Strict makes Read (and so Skip and SkipValue) reject encodings that a
+	// canonical encoder would not produce: over-long integers and length
+	// headers, invalid UTF-8 in strings and duplicate map keys.
+	Strict bool
+	// ValidateUTF8 makes Read return ErrInvalidUTF8 for a str value whose
+	// payload is not valid UTF-8. Strict implies it.
+	ValidateUTF8 bool
+	// tracker finds duplicate map keys for Strict.
+	tracker keyTracker
 }
 
 func (r *MsgpReader) need(n int) error {
@@ -43,6 +52,9 @@ func (r *MsgpReader) need(n int) error {
 
 // Read reads the next msgp value. See IMsgpReader for return value semantics.
 func (r *MsgpReader) Read() (Type, int, []byte, error) {
+	if r.Strict || r.ValidateUTF8 {
+		return r.readChecked()
+	}
 	if r.Idx >= len(r.Buff) {
 		return Type(0), 0, nil, EOF
 	}
@@ -259,3 +271,36 @@ func (r *MsgpReader) Skip() error {
 	_, _, _, err := r.Read()
 	return err
 }
+
+// SkipValue advances past the next value. Unlike Skip, arrays and maps are
+// skipped together with all of their children.
+func (r *MsgpReader) SkipValue() error {
+	_, err := r.skipValue()
+	return err
+}
+
+// skipValue advances past the next value including, for arrays and maps, all
+// of its children. It returns the number of values consumed (the value itself
+// plus every descendant). Running out of input inside a container is reported
+// as ErrTruncated, not EOF.
+func (r *MsgpReader) skipValue() (int, error) {
+	nodes, pending := 0, 1
+	for pending > 0 {
+		t, n, _, err := r.Read()
+		if err != nil {
+			if err == EOF && nodes > 0 {
+				return nodes, ErrTruncated
+			}
+			return nodes, err
+		}
+		nodes++
+		pending--
+		switch {
+		case t.isArray():
+			pending += n
+		case t.isMap():
+			pending += 2 * n
+		}
+	}
+	return nodes, nil
+}
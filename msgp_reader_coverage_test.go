@@ -382,6 +382,30 @@ func TestReader_Skip(t *testing.T) {
 	assert.True(t, errors.Is(r.Skip(), io.EOF))
 }
 
+func TestReader_SkipValue(t *testing.T) {
+	// [ {"k": [1, 2]}, "x" ] followed by a top-level nil.
+	w := &MsgpWriter{}
+	require.NoError(t, w.WriteArray(2))
+	require.NoError(t, w.WriteMap(1))
+	require.NoError(t, w.WriteString("k"))
+	require.NoError(t, w.WriteArray16(2))
+	require.NoError(t, w.WriteInt8(1))
+	require.NoError(t, w.WriteInt8(2))
+	require.NoError(t, w.WriteString("x"))
+	require.NoError(t, w.WriteNil())
+
+	r := &MsgpReader{Buff: w.Buff}
+	require.NoError(t, r.SkipValue())
+	ty, _, _, err := r.Read()
+	require.NoError(t, err)
+	assert.Equal(t, Nil, ty)
+	assert.True(t, errors.Is(r.SkipValue(), io.EOF))
+
+	// Running out of input inside a container is truncation, not EOF.
+	r = &MsgpReader{Buff: w.Buff[:len(w.Buff)-3]}
+	assert.True(t, errors.Is(r.SkipValue(), ErrTruncated))
+}
+
 func TestReader_Read_Nested(t *testing.T) {
 	// Build: Array16(2) -> [Map16(1) -> {"k": 42}, "tail"]
 	w := &MsgpWriter{}
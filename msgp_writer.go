@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"math"
+	"unicode/utf8"
 )
 
 var (
@@ -101,6 +102,25 @@ type IMsgpWriter interface {
 // callers can pre-size it: w := &MsgpWriter{Buff: make([]byte, 0, n)}.
 type MsgpWriter struct {
 	Buff []byte
+
+	// CompactHeaders makes End rewrite the Array32/Map32 header reserved by
+	// BeginArray/BeginMap to the smallest format that holds the final count,
+	// shifting the container's body left.
+	CompactHeaders bool
+
+	// ValidateUTF8 makes WriteString return ErrInvalidUTF8 instead of
+	// writing a string that is not valid UTF-8. The explicit WriteFixStr and
+	// WriteStr* methods write their input unchecked.
+	ValidateUTF8 bool
+
+	// deferred holds the header offsets of containers opened by BeginArray
+	// and BeginMap that have not been ended yet, innermost last.
+	deferred []int
+
+	// cuts and gen let Rollback tell whether Buff was cut back below a mark
+	// since it was taken; see cutTo.
+	cuts []cut
+	gen  uint64
 }
 
 // --- scalars ----------------------------------------------------------------
@@ -124,6 +144,42 @@ func (w *MsgpWriter) WriteNegFixInt(i int8) error {
 func (w *MsgpWriter) WriteInt(i int) error    { return w.WriteInt64(int64(i)) }
 func (w *MsgpWriter) WriteUint(u uint) error  { return w.WriteUint64(uint64(u)) }
 
+// writeIntCompact writes i in the shortest integer format that holds it.
+// Non-negative values use the unsigned family, matching what other msgpack
+// encoders produce.
+func (w *MsgpWriter) writeIntCompact(i int64) error {
+	switch {
+	case i >= 0:
+		return w.writeUintCompact(uint64(i))
+	case i >= -32:
+		return w.WriteNegFixInt(int8(i))
+	case i >= math.MinInt8:
+		return w.WriteInt8(int8(i))
+	case i >= math.MinInt16:
+		return w.WriteInt16(int16(i))
+	case i >= math.MinInt32:
+		return w.WriteInt32(int32(i))
+	default:
+		return w.WriteInt64(i)
+	}
+}
+
+// writeUintCompact writes u in the shortest integer format that holds it.
+func (w *MsgpWriter) writeUintCompact(u uint64) error {
+	switch {
+	case u <= uint64(PosFixIntMax):
+		return w.WritePosFixInt(uint8(u))
+	case u <= maxUint8:
+		return w.WriteUint8(uint8(u))
+	case u <= maxUint16:
+		return w.WriteUint16(uint16(u))
+	case u <= maxUint32:
+		return w.WriteUint32(uint32(u))
+	default:
+		return w.WriteUint64(u)
+	}
+}
+
 func (w *MsgpWriter) WriteInt8(i int8) error {
 	w.Buff = append(w.Buff, byte(Int8), byte(i))
 	return nil
@@ -198,7 +254,12 @@ func (w *MsgpWriter) WriteBool(b bool) error {
 
 // --- strings (auto + explicit) ---------------------------------------------
 
+// WriteString writes s in the smallest str format that fits. With
+// ValidateUTF8 set it refuses a string that is not valid UTF-8.
 func (w *MsgpWriter) WriteString(s string) error {
+	if w.ValidateUTF8 && !utf8.ValidString(s) {
+		return ErrInvalidUTF8
+	}
 	n := len(s)
 	switch {
 	case n <= maxFixStr:
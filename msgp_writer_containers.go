@@ -0,0 +1,129 @@
+package msgpraw
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var (
+	ErrContainerMismatch   = errors.New("msgpraw: End called with a container that is not open")
+	ErrContainerIncomplete = errors.New("msgpraw: container closed before all of its elements were written")
+)
+
+// deferredHeaderSize is the size of the Array32/Map32 header reserved by
+// BeginArray and BeginMap.
+const deferredHeaderSize = 5
+
+// Container is a handle to a container opened by BeginArray or BeginMap.
+type Container struct {
+	depth  int
+	header int
+}
+
+// BeginArray starts an array whose length is not known yet. It reserves an
+// Array32 header; write the elements with the usual Write* methods and then
+// call End with the returned handle to patch in the count.
+func (w *MsgpWriter) BeginArray() Container {
+	return w.begin(Array32)
+}
+
+// BeginMap starts a map whose length is not known yet. It reserves a Map32
+// header; write alternating keys and values and then call End with the
+// returned handle to patch in the pair count.
+func (w *MsgpWriter) BeginMap() Container {
+	return w.begin(Map32)
+}
+
+func (w *MsgpWriter) begin(t Type) Container {
+	c := Container{depth: len(w.deferred), header: len(w.Buff)}
+	w.Buff = append(w.Buff, byte(t), 0, 0, 0, 0)
+	w.deferred = append(w.deferred, c.header)
+	return c
+}
+
+// End closes a container opened by BeginArray or BeginMap and writes the
+// number of children written since into its header. Children are counted by
+// scanning the container's body, so the plain Write* methods carry no
+// bookkeeping cost; the scan is linear in the body size.
+//
+// Containers must be ended innermost first: ending an outer container while
+// an inner one is open returns ErrContainerIncomplete, as does a body that
+// ends inside a fixed-size child (e.g. WriteArray(3) followed by only two
+// values) or a map body with a key but no value.
+//
+// With CompactHeaders set the header is shrunk to the smallest format that
+// fits, moving the body; offsets into the body taken earlier become stale.
+func (w *MsgpWriter) End(c Container) error {
+	if c.depth >= len(w.deferred) || w.deferred[c.depth] != c.header {
+		return ErrContainerMismatch
+	}
+	if c.depth != len(w.deferred)-1 {
+		return ErrContainerIncomplete
+	}
+
+	isMap := Type(w.Buff[c.header]) == Map32
+	n, err := countValues(w.Buff[c.header+deferredHeaderSize:])
+	if err != nil {
+		return err
+	}
+	if isMap {
+		if n%2 != 0 {
+			return ErrContainerIncomplete
+		}
+		n /= 2
+	}
+	if uint64(n) > maxUint32 {
+		if isMap {
+			return ErrMapTooLong
+		}
+		return ErrArrayTooLong
+	}
+
+	binary.BigEndian.PutUint32(w.Buff[c.header+1:], uint32(n))
+	if w.CompactHeaders {
+		w.compactHeader(c.header, isMap, n)
+	}
+	w.deferred = w.deferred[:c.depth]
+	return nil
+}
+
+// countValues returns how many complete top-level values buf holds.
+func countValues(buf []byte) (int, error) {
+	r := MsgpReader{Buff: buf}
+	n := 0
+	for r.Idx < len(r.Buff) {
+		if err := r.SkipValue(); err != nil {
+			if err == ErrTruncated {
+				return 0, ErrContainerIncomplete
+			}
+			return 0, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// compactHeader rewrites the Array32/Map32 header at off to the smallest
+// header for n elements and moves the body that follows it.
+func (w *MsgpWriter) compactHeader(off int, isMap bool, n int) {
+	var hdr [3]byte
+	var size int
+	switch {
+	case n <= maxFixArray: // same limit as maxFixMap
+		hdr[0], size = byte(FixArray)|byte(n), 1
+		if isMap {
+			hdr[0] = byte(FixMap) | byte(n)
+		}
+	case n <= maxUint16:
+		hdr[0], size = byte(Array16), 3
+		if isMap {
+			hdr[0] = byte(Map16)
+		}
+		binary.BigEndian.PutUint16(hdr[1:], uint16(n))
+	default:
+		return
+	}
+	copy(w.Buff[off:], hdr[:size])
+	copy(w.Buff[off+size:], w.Buff[off+deferredHeaderSize:])
+	w.Buff = w.Buff[:len(w.Buff)-deferredHeaderSize+size]
+}
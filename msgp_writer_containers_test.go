@@ -0,0 +1,155 @@
+package msgpraw
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriter_BeginArray_End(t *testing.T) {
+	w := &MsgpWriter{}
+	c := w.BeginArray()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, w.WriteInt8(int8(i)))
+	}
+	require.NoError(t, w.End(c))
+
+	assert.Equal(t, []byte{byte(Array32), 0, 0, 0, 3}, w.Buff[:5])
+	r := &MsgpReader{Buff: w.Buff}
+	ty, n, _, err := r.Read()
+	require.NoError(t, err)
+	assert.Equal(t, Array32, ty)
+	assert.Equal(t, 3, n)
+}
+
+func TestWriter_BeginMap_Nested(t *testing.T) {
+	// {"rows": [[1, 2], [3]], "n": {}}
+	w := &MsgpWriter{}
+	m := w.BeginMap()
+	require.NoError(t, w.WriteString("rows"))
+	rows := w.BeginArray()
+	require.NoError(t, w.WriteArray(2))
+	require.NoError(t, w.WriteInt8(1))
+	require.NoError(t, w.WriteInt8(2))
+	row := w.BeginArray()
+	require.NoError(t, w.WriteInt8(3))
+	require.NoError(t, w.End(row))
+	require.NoError(t, w.End(rows))
+	require.NoError(t, w.WriteString("n"))
+	empty := w.BeginMap()
+	require.NoError(t, w.End(empty))
+	require.NoError(t, w.End(m))
+
+	v, err := DecodeValue(&MsgpReader{Buff: w.Buff})
+	require.NoError(t, err)
+	require.Equal(t, 2, v.Len())
+	got, ok := v.Get("rows")
+	require.True(t, ok)
+	require.Equal(t, 2, got.Len())
+	assert.Equal(t, 2, got.Index(0).Len())
+	assert.Equal(t, int64(3), got.Index(1).Index(0).Int())
+	got, ok = v.Get("n")
+	require.True(t, ok)
+	assert.Equal(t, KindMap, got.Kind())
+	assert.Equal(t, 0, got.Len())
+}
+
+func TestWriter_End_CompactHeaders(t *testing.T) {
+	cases := []struct {
+		name    string
+		isMap   bool
+		n       int
+		wantTag Type
+		hdrSize int
+	}{
+		{"fixarray", false, 3, FixArray | 3, 1},
+		{"array16", false, 300, Array16, 3},
+		{"array32", false, 70000, Array32, 5},
+		{"fixmap", true, 2, FixMap | 2, 1},
+		{"map16", true, 20, Map16, 3},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := &MsgpWriter{CompactHeaders: true}
+			require.NoError(t, w.WriteNil())
+			var c Container
+			count := tc.n
+			if tc.isMap {
+				c = w.BeginMap()
+				count *= 2
+			} else {
+				c = w.BeginArray()
+			}
+			for i := 0; i < count; i++ {
+				require.NoError(t, w.WritePosFixInt(1))
+			}
+			require.NoError(t, w.End(c))
+			assert.Equal(t, 1+tc.hdrSize+count, len(w.Buff))
+
+			r := &MsgpReader{Buff: w.Buff}
+			require.NoError(t, r.Skip())
+			ty, n, _, err := r.Read()
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantTag, ty)
+			assert.Equal(t, tc.n, n)
+			for i := 0; i < count; i++ {
+				ty, _, _, err = r.Read()
+				require.NoError(t, err)
+				assert.Equal(t, Type(1), ty)
+			}
+			assert.Equal(t, len(w.Buff), r.Idx)
+		})
+	}
+}
+
+func TestWriter_End_Errors(t *testing.T) {
+	t.Run("outer_before_inner", func(t *testing.T) {
+		w := &MsgpWriter{}
+		outer := w.BeginArray()
+		inner := w.BeginArray()
+		require.ErrorIs(t, w.End(outer), ErrContainerIncomplete)
+		require.NoError(t, w.End(inner))
+		require.NoError(t, w.End(outer))
+	})
+	t.Run("ended_twice", func(t *testing.T) {
+		w := &MsgpWriter{}
+		c := w.BeginArray()
+		require.NoError(t, w.End(c))
+		require.ErrorIs(t, w.End(c), ErrContainerMismatch)
+	})
+	t.Run("zero_handle", func(t *testing.T) {
+		w := &MsgpWriter{}
+		require.ErrorIs(t, w.End(Container{}), ErrContainerMismatch)
+	})
+	t.Run("underfilled_child", func(t *testing.T) {
+		w := &MsgpWriter{}
+		c := w.BeginArray()
+		require.NoError(t, w.WriteArray(3))
+		require.NoError(t, w.WriteNil())
+		require.ErrorIs(t, w.End(c), ErrContainerIncomplete)
+	})
+	t.Run("map_key_without_value", func(t *testing.T) {
+		w := &MsgpWriter{}
+		c := w.BeginMap()
+		require.NoError(t, w.WriteString("k"))
+		require.ErrorIs(t, w.End(c), ErrContainerIncomplete)
+		require.NoError(t, w.WriteNil())
+		require.NoError(t, w.End(c))
+	})
+}
+
+func BenchmarkWriter_BeginArray_End(b *testing.B) {
+	scratch := make([]byte, 0, 4096)
+	w := MsgpWriter{CompactHeaders: true}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w.Buff = scratch[:0]
+		c := w.BeginArray()
+		for j := 0; j < 100; j++ {
+			_ = w.WriteInt64(int64(j))
+		}
+		_ = w.End(c)
+	}
+}
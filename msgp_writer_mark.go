@@ -0,0 +1,149 @@
+package msgpraw
+
+import (
+	"errors"
+	"sort"
+)
+
+var (
+	ErrStaleMark           = errors.New("msgpraw: mark refers to state that has since been overwritten")
+	ErrTruncateUnsupported = errors.New("msgpraw: CheckedWriter does not support Truncate; use Checkpoint and Rollback")
+)
+
+// Mark records a writer's position for a later Rollback.
+type Mark struct {
+	size  int
+	depth int    // open deferred containers
+	top   int    // header offset of the innermost one, -1 if none
+	gen   uint64 // the writer's gen when the mark was taken
+
+	// CheckedWriter state; unused by MsgpWriter.
+	open []checkedFrame
+	done bool
+}
+
+// Reset empties the writer for reuse, keeping Buff's capacity and the
+// option fields. Open containers are discarded.
+func (w *MsgpWriter) Reset() {
+	w.Buff = w.Buff[:0]
+	w.deferred = w.deferred[:0]
+	w.cutTo(0)
+}
+
+// Len returns the number of bytes written.
+func (w *MsgpWriter) Len() int { return len(w.Buff) }
+
+// Truncate discards all but the first n bytes of Buff, along with any
+// container opened by BeginArray or BeginMap whose header lies in the
+// discarded part. It panics if n is negative or greater than Len.
+func (w *MsgpWriter) Truncate(n int) {
+	if n < 0 || n > len(w.Buff) {
+		panic("msgpraw: truncation out of range")
+	}
+	w.Buff = w.Buff[:n]
+	w.cutTo(n)
+	for len(w.deferred) > 0 && w.deferred[len(w.deferred)-1] >= n {
+		w.deferred = w.deferred[:len(w.deferred)-1]
+	}
+}
+
+// Checkpoint returns a mark for the current position.
+func (w *MsgpWriter) Checkpoint() Mark {
+	m := Mark{size: len(w.Buff), depth: len(w.deferred), top: -1, gen: w.gen}
+	if m.depth > 0 {
+		m.top = w.deferred[m.depth-1]
+	}
+	return m
+}
+
+// Rollback undoes everything written since m was taken: Buff is truncated
+// back and containers opened since are discarded. It returns ErrStaleMark,
+// leaving the writer untouched, if that history has been rewritten in the
+// meantime: Buff was cut back below m's position by an earlier Rollback,
+// Truncate or Reset, even if it has grown past it again, or a container that
+// was open at m has been ended. Rolling back to the same mark repeatedly is
+// fine.
+func (w *MsgpWriter) Rollback(m Mark) error {
+	if !w.validMark(m) {
+		return ErrStaleMark
+	}
+	w.Buff = w.Buff[:m.size]
+	w.deferred = w.deferred[:m.depth]
+	w.cutTo(m.size)
+	return nil
+}
+
+func (w *MsgpWriter) validMark(m Mark) bool {
+	if m.size > len(w.Buff) || m.depth > len(w.deferred) {
+		return false
+	}
+	// cuts grow in both gen and size, so the first cut made after m is the
+	// deepest of them.
+	i := sort.Search(len(w.cuts), func(i int) bool { return w.cuts[i].gen > m.gen })
+	if i < len(w.cuts) && w.cuts[i].size < m.size {
+		return false
+	}
+	return m.depth == 0 || w.deferred[m.depth-1] == m.top
+}
+
+// cut is a point where Buff was cut back to size, numbered by gen.
+type cut struct {
+	gen  uint64
+	size int
+}
+
+// cutTo records that Buff was cut back to n bytes. Earlier cuts at n or
+// above are dropped: any mark they would invalidate is invalidated by this
+// one as well.
+func (w *MsgpWriter) cutTo(n int) {
+	for len(w.cuts) > 0 && w.cuts[len(w.cuts)-1].size >= n {
+		w.cuts = w.cuts[:len(w.cuts)-1]
+	}
+	w.gen++
+	w.cuts = append(w.cuts, cut{gen: w.gen, size: n})
+}
+
+// Reset empties the writer and its container stack for the next message.
+func (c *CheckedWriter) Reset() {
+	c.MsgpWriter.Reset()
+	c.open = c.open[:0]
+	c.done = false
+}
+
+// Truncate hides MsgpWriter.Truncate, which would leave the container stack
+// out of step with Buff: the element counts of the containers open at n
+// can't be recovered from the bytes. It always returns
+// ErrTruncateUnsupported and leaves the writer untouched; use Checkpoint and
+// Rollback, which restore the counts, or Reset.
+func (c *CheckedWriter) Truncate(n int) error {
+	return ErrTruncateUnsupported
+}
+
+// Checkpoint returns a mark for the current position, including the
+// element counts of the open containers.
+func (c *CheckedWriter) Checkpoint() Mark {
+	m := c.MsgpWriter.Checkpoint()
+	m.open = append([]checkedFrame(nil), c.open...)
+	m.done = c.done
+	return m
+}
+
+// Rollback is MsgpWriter.Rollback that also restores the container stack,
+// so a half-written record can be dropped and rewritten. m must come from
+// c.Checkpoint. In Canonical mode a map that was open at m and has been
+// completed (and so sorted) since makes m stale.
+func (c *CheckedWriter) Rollback(m Mark) error {
+	if c.Canonical {
+		for i, f := range m.open {
+			if f.isMap && !f.deferred && (i >= len(c.open) || c.open[i].body != f.body) {
+				return ErrStaleMark
+			}
+		}
+	}
+	if err := c.MsgpWriter.Rollback(m); err != nil {
+		return err
+	}
+	c.open = append(c.open[:0], m.open...)
+	c.done = m.done
+	return nil
+}
@@ -0,0 +1,145 @@
+package msgpraw
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriter_ResetLenTruncate(t *testing.T) {
+	w := &MsgpWriter{Buff: make([]byte, 0, 64), CompactHeaders: true}
+	require.NoError(t, w.WriteString("abc"))
+	assert.Equal(t, 4, w.Len())
+
+	w.BeginArray()
+	require.NoError(t, w.WriteNil())
+	w.Truncate(4)
+	assert.Equal(t, 4, w.Len())
+	assert.Empty(t, w.deferred, "container whose header was cut off is dropped")
+	assert.Panics(t, func() { w.Truncate(5) })
+	assert.Panics(t, func() { w.Truncate(-1) })
+
+	w.BeginMap()
+	w.Reset()
+	assert.Equal(t, 0, w.Len())
+	assert.Equal(t, 64, cap(w.Buff))
+	assert.Empty(t, w.deferred)
+	assert.True(t, w.CompactHeaders, "options survive Reset")
+}
+
+func TestWriter_Rollback(t *testing.T) {
+	w := &MsgpWriter{}
+	arr := w.BeginArray()
+	require.NoError(t, w.WriteInt(1))
+
+	m := w.Checkpoint()
+	require.NoError(t, w.WriteMap(1))
+	w.BeginArray() // left open by the failed record
+	require.NoError(t, w.WriteString("half"))
+	require.NoError(t, w.Rollback(m))
+
+	require.NoError(t, w.WriteInt(2))
+	require.NoError(t, w.End(arr))
+
+	v, err := DecodeValue(&MsgpReader{Buff: w.Buff})
+	require.NoError(t, err)
+	require.Equal(t, 2, v.Len())
+	assert.Equal(t, int64(2), v.Index(1).Int())
+}
+
+func TestWriter_RollbackStale(t *testing.T) {
+	w := &MsgpWriter{}
+	arr := w.BeginArray()
+	m := w.Checkpoint()
+	require.NoError(t, w.End(arr))
+	n := len(w.Buff)
+	require.ErrorIs(t, w.Rollback(m), ErrStaleMark, "container open at the mark was ended")
+	assert.Equal(t, n, len(w.Buff))
+
+	w.Reset()
+	require.NoError(t, w.WriteNil())
+	m = w.Checkpoint()
+	w.Truncate(0)
+	require.ErrorIs(t, w.Rollback(m), ErrStaleMark)
+}
+
+func TestWriter_RollbackRewritten(t *testing.T) {
+	w := &MsgpWriter{}
+	m1 := w.Checkpoint()
+	require.NoError(t, w.WriteString("first"))
+	m2 := w.Checkpoint()
+	require.NoError(t, w.WriteString("second"))
+
+	// Going back to m2 repeatedly, then to the earlier m1, is fine.
+	require.NoError(t, w.Rollback(m2))
+	require.NoError(t, w.WriteString("again"))
+	require.NoError(t, w.Rollback(m2))
+	require.NoError(t, w.Rollback(m1))
+
+	// Bytes now behind m2 belong to a new record, even once Buff is long
+	// enough again.
+	require.NoError(t, w.WriteString("a much longer record"))
+	n := len(w.Buff)
+	require.ErrorIs(t, w.Rollback(m2), ErrStaleMark)
+	assert.Equal(t, n, len(w.Buff))
+	require.NoError(t, w.Rollback(m1))
+
+	require.NoError(t, w.WriteNil())
+	m3 := w.Checkpoint()
+	require.NoError(t, w.WriteString("abc"))
+	w.Reset()
+	require.NoError(t, w.WriteString("abcdef"))
+	require.ErrorIs(t, w.Rollback(m3), ErrStaleMark)
+}
+
+func TestCheckedWriter_Rollback(t *testing.T) {
+	c := NewCheckedWriter(&MsgpWriter{})
+	require.NoError(t, c.WriteArray(2))
+	require.NoError(t, c.WriteNil())
+
+	m := c.Checkpoint()
+	require.NoError(t, c.WriteMap(2))
+	require.NoError(t, c.WriteString("a"))
+	require.NoError(t, c.Rollback(m))
+	assert.Equal(t, 1, c.Depth())
+
+	require.NoError(t, c.WriteBool(true))
+	require.NoError(t, c.Complete())
+
+	m = c.Checkpoint()
+	require.NoError(t, c.WriteNil())
+	require.ErrorIs(t, c.WriteNil(), ErrContainerOverflow)
+	require.NoError(t, c.Rollback(m))
+	require.NoError(t, c.WriteNil())
+
+	c.Reset()
+	assert.Equal(t, 0, c.Len())
+	require.NoError(t, c.WriteNil())
+	require.NoError(t, c.Complete())
+
+	require.ErrorIs(t, c.Truncate(0), ErrTruncateUnsupported)
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestCheckedWriter_RollbackCanonicalSorted(t *testing.T) {
+	c := NewCheckedWriter(&MsgpWriter{})
+	c.Canonical = true
+	require.NoError(t, c.WriteMap(2))
+	require.NoError(t, c.WriteString("b"))
+	require.NoError(t, c.WriteNil())
+	m := c.Checkpoint()
+	require.NoError(t, c.WriteString("a"))
+	require.NoError(t, c.WriteNil()) // sorts the map across the mark
+	require.ErrorIs(t, c.Rollback(m), ErrStaleMark)
+}
+
+func TestWriter_CheckpointNoAllocs(t *testing.T) {
+	w := &MsgpWriter{Buff: make([]byte, 0, 64)}
+	allocs := testing.AllocsPerRun(100, func() {
+		m := w.Checkpoint()
+		_ = w.WriteString("record")
+		_ = w.Rollback(m)
+	})
+	require.Zero(t, allocs)
+}
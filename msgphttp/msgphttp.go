@@ -0,0 +1,202 @@
+// Package msgphttp serves net/http requests and responses whose bodies are
+// application/msgpack, using pooled msgpraw readers and writers.
+package msgphttp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/marino39/msgpraw"
+)
+
+// ContentType is the media type of request and response bodies.
+// "application/x-msgpack" is accepted on requests as well.
+const ContentType = "application/msgpack"
+
+// DefaultMaxBodySize is the request body limit of a Handler whose
+// MaxBodySize is zero.
+const DefaultMaxBodySize = 4 << 20
+
+var (
+	ErrUnsupportedMediaType = errors.New("msgphttp: request body is not application/msgpack")
+	ErrBodyTooLarge         = errors.New("msgphttp: request body too large")
+	ErrMalformedBody        = errors.New("msgphttp: request body is not a single msgpack value")
+)
+
+// Error carries the HTTP status to answer with. A Serve function may return
+// one to have its message sent to the client; any other error is answered
+// with a plain 500 that doesn't reveal it. A zero Status means 500, and a nil
+// Err sends the status text.
+type Error struct {
+	Status int
+	Err    error
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return http.StatusText(e.status())
+	}
+	return e.Err.Error()
+}
+
+func (e *Error) status() int {
+	if e.Status == 0 {
+		return http.StatusInternalServerError
+	}
+	return e.Status
+}
+func (e *Error) Unwrap() error { return e.Err }
+
+// Response is the response being built by a Serve function. The body is
+// written through the embedded pooled writer and sent as application/msgpack
+// once Serve returns; an empty body is sent as 204 No Content.
+type Response struct {
+	*msgpraw.MsgpWriter
+	// Status defaults to 200; zero is sent as 200 too.
+	Status int
+	Header http.Header
+}
+
+// Handler is an http.Handler for msgpack endpoints. It reads and checks the
+// request body and hands it to Serve as a reader positioned at its single
+// value; a request without a body gets an empty reader. Body bytes come from
+// a pool and must not be retained after Serve returns.
+type Handler struct {
+	Serve func(resp *Response, req *http.Request, body *msgpraw.MsgpReader) error
+	// MaxBodySize bounds the request body; a larger one is answered with
+	// 413. Zero means DefaultMaxBodySize.
+	MaxBodySize int64
+	// Strict decodes the body with MsgpReader.Strict.
+	Strict bool
+	// Schema, if set, must match the body; violations are answered with
+	// 422 and listed in the response text.
+	Schema *msgpraw.Schema
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	limit := h.MaxBodySize
+	if limit == 0 {
+		limit = DefaultMaxBodySize
+	}
+	buf := msgpraw.AcquireWriter()
+	defer msgpraw.ReleaseWriter(buf)
+	var err error
+	buf.Buff, err = ReadBody(buf.Buff, w, req, limit)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	body := msgpraw.AcquireReader(buf.Buff)
+	defer msgpraw.ReleaseReader(body)
+	body.Strict = h.Strict
+	if len(body.Buff) > 0 {
+		err := body.SkipValue()
+		if err != nil {
+			// Keep the reason, such as a Strict rule, for the client.
+			err = fmt.Errorf("%w: %v", ErrMalformedBody, err)
+		} else if body.Idx != len(body.Buff) {
+			err = ErrMalformedBody
+		}
+		if err != nil {
+			writeError(w, &Error{Status: http.StatusBadRequest, Err: err})
+			return
+		}
+		body.Idx = 0
+	}
+	if h.Schema != nil {
+		if err := h.Schema.Validate(body.Buff); err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, msgpraw.ErrSchemaViolation) {
+				status = http.StatusUnprocessableEntity
+			}
+			writeError(w, &Error{Status: status, Err: err})
+			return
+		}
+	}
+
+	resp := Response{MsgpWriter: msgpraw.AcquireWriter(), Status: http.StatusOK, Header: w.Header()}
+	defer msgpraw.ReleaseWriter(resp.MsgpWriter)
+	if err := h.Serve(&resp, req, body); err != nil {
+		writeError(w, err)
+		return
+	}
+	status := resp.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if len(resp.Buff) == 0 && status == http.StatusOK {
+		status = http.StatusNoContent
+	}
+	Write(w, status, resp.Buff)
+}
+
+// ReadBody appends the body of req to dst, enforcing limit through
+// http.MaxBytesReader on w. A body with another content type is
+// ErrUnsupportedMediaType and one over the limit ErrBodyTooLarge, both
+// wrapped in an *Error with the matching status.
+func ReadBody(dst []byte, w http.ResponseWriter, req *http.Request, limit int64) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return dst, nil
+	}
+	if req.ContentLength > limit {
+		return dst, &Error{Status: http.StatusRequestEntityTooLarge, Err: ErrBodyTooLarge}
+	}
+	if req.ContentLength != 0 || req.Header.Get("Content-Type") != "" {
+		mt, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+		if err != nil || (mt != ContentType && mt != "application/x-msgpack") {
+			return dst, &Error{Status: http.StatusUnsupportedMediaType, Err: ErrUnsupportedMediaType}
+		}
+	}
+	if n := req.ContentLength; n > 0 && int64(cap(dst)-len(dst)) < n {
+		grown := make([]byte, len(dst), len(dst)+int(n))
+		copy(grown, dst)
+		dst = grown
+	}
+	r := http.MaxBytesReader(w, req.Body, limit)
+	for {
+		if len(dst) == cap(dst) {
+			dst = append(dst, 0)[:len(dst)]
+		}
+		n, err := r.Read(dst[len(dst):cap(dst)])
+		dst = dst[:len(dst)+n]
+		if err == io.EOF {
+			return dst, nil
+		}
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				return dst, &Error{Status: http.StatusRequestEntityTooLarge, Err: ErrBodyTooLarge}
+			}
+			return dst, &Error{Status: http.StatusBadRequest, Err: err}
+		}
+	}
+}
+
+// Write sends body as an application/msgpack response with the given
+// status. A 204 response is sent without a body or content headers.
+func Write(w http.ResponseWriter, status int, body []byte) {
+	if status == http.StatusNoContent {
+		w.WriteHeader(status)
+		return
+	}
+	h := w.Header()
+	h.Set("Content-Type", ContentType)
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	var e *Error
+	if !errors.As(err, &e) {
+		status := http.StatusInternalServerError
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	http.Error(w, err.Error(), e.status())
+}
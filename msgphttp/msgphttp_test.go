@@ -0,0 +1,185 @@
+package msgphttp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/marino39/msgpraw"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func encodeMap(t *testing.T, kv ...any) []byte {
+	w := &msgpraw.MsgpWriter{}
+	require.NoError(t, w.WriteMap(len(kv)/2))
+	for i := 0; i < len(kv); i += 2 {
+		require.NoError(t, w.WriteString(kv[i].(string)))
+		switch v := kv[i+1].(type) {
+		case string:
+			require.NoError(t, w.WriteString(v))
+		case int:
+			require.NoError(t, w.WriteInt(v))
+		}
+	}
+	return w.Buff
+}
+
+// greet answers {"name": s} with {"hello": s}.
+func greet(resp *Response, req *http.Request, body *msgpraw.MsgpReader) error {
+	doc := msgpraw.NewDocument(body.Buff)
+	name, err := doc.Get("name").Str()
+	if err != nil {
+		return &Error{Status: http.StatusBadRequest, Err: err}
+	}
+	if name == "boom" {
+		return errors.New("database password is hunter2")
+	}
+	resp.Header.Set("X-Greeting", "1")
+	if err := resp.WriteMap(1); err != nil {
+		return err
+	}
+	if err := resp.WriteString("hello"); err != nil {
+		return err
+	}
+	return resp.WriteString(name)
+}
+
+func do(h http.Handler, contentType string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandler_OK(t *testing.T) {
+	h := &Handler{Serve: greet}
+	rec := do(h, ContentType, encodeMap(t, "name", "ann"))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, ContentType, rec.Header().Get("Content-Type"))
+	assert.Equal(t, "1", rec.Header().Get("X-Greeting"))
+	assert.Equal(t, encodeMap(t, "hello", "ann"), rec.Body.Bytes())
+	assert.Equal(t, strconv.Itoa(rec.Body.Len()), rec.Header().Get("Content-Length"))
+
+	rec = do(h, "application/x-msgpack; charset=binary", encodeMap(t, "name", "bo"))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestHandler_Errors(t *testing.T) {
+	h := &Handler{Serve: greet, MaxBodySize: 32}
+
+	rec := do(h, "application/json", []byte(`{"name":"ann"}`))
+	assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+
+	rec = do(h, ContentType, encodeMap(t, "name", strings.Repeat("x", 64)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+
+	rec = do(h, ContentType, []byte{0x81, 0xa4})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), ErrMalformedBody.Error())
+
+	rec = do(h, ContentType, []byte{0xc0, 0xc0})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = do(h, ContentType, encodeMap(t, "other", 1))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = do(h, ContentType, encodeMap(t, "name", "boom"))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "hunter2")
+}
+
+func TestHandler_BodyTooLargeWithoutLength(t *testing.T) {
+	h := &Handler{Serve: greet, MaxBodySize: 8}
+	req := httptest.NewRequest(http.MethodPost, "/", io.MultiReader(bytes.NewReader(encodeMap(t, "name", "abcdefghij"))))
+	req.ContentLength = -1
+	req.Header.Set("Content-Type", ContentType)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+}
+
+func TestHandler_Strict(t *testing.T) {
+	h := &Handler{Serve: greet, Strict: true}
+	// "name" as Str8 is not the shortest encoding.
+	body := []byte{0x81, byte(msgpraw.Str8), 4, 'n', 'a', 'm', 'e', 0xa1, 'x'}
+	rec := do(h, ContentType, body)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), ErrMalformedBody.Error())
+	assert.Contains(t, rec.Body.String(), msgpraw.ErrNonCanonicalLength.Error())
+	h.Strict = false
+	rec = do(h, ContentType, body)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestHandler_ZeroStatus(t *testing.T) {
+	h := &Handler{Serve: func(resp *Response, req *http.Request, body *msgpraw.MsgpReader) error {
+		return &Error{}
+	}}
+	rec := do(h, "", nil)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Contains(t, rec.Body.String(), http.StatusText(http.StatusInternalServerError))
+
+	h.Serve = func(resp *Response, req *http.Request, body *msgpraw.MsgpReader) error {
+		resp.Status = 0
+		return resp.WriteNil()
+	}
+	rec = do(h, "", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, []byte{byte(msgpraw.Nil)}, rec.Body.Bytes())
+
+	h.Serve = func(resp *Response, req *http.Request, body *msgpraw.MsgpReader) error {
+		resp.Status = 0
+		return nil
+	}
+	rec = do(h, "", nil)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+}
+
+func TestHandler_Schema(t *testing.T) {
+	s, err := msgpraw.ParseSchema([]byte(`{"type":"map","properties":{"name":{"type":"str"}},"required":["name"]}`))
+	require.NoError(t, err)
+	h := &Handler{Serve: greet, Schema: s}
+
+	rec := do(h, ContentType, encodeMap(t, "name", 5))
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Contains(t, rec.Body.String(), "$.name")
+
+	rec = do(h, ContentType, encodeMap(t, "name", "ann"))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestHandler_NoBody(t *testing.T) {
+	var got int
+	h := &Handler{Serve: func(resp *Response, req *http.Request, body *msgpraw.MsgpReader) error {
+		got = len(body.Buff)
+		return nil
+	}}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Zero(t, got)
+	assert.Empty(t, rec.Header().Get("Content-Type"))
+}
+
+func TestHandler_Server(t *testing.T) {
+	srv := httptest.NewServer(&Handler{Serve: greet})
+	defer srv.Close()
+
+	res, err := http.Post(srv.URL, ContentType, bytes.NewReader(encodeMap(t, "name", "net")))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, encodeMap(t, "hello", "net"), body)
+}
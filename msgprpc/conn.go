@@ -0,0 +1,226 @@
+package msgprpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/marino39/msgpraw"
+)
+
+var (
+	ErrClosed    = errors.New("msgprpc: connection closed")
+	ErrNoHandler = errors.New("msgprpc: no handler for requests")
+)
+
+// Handler serves incoming requests and notifications. params is an encoded
+// array that stays valid after ServeRPC returns. For a request, the encoded
+// result or the error is sent back to the caller; for a notification both
+// are dropped.
+type Handler interface {
+	ServeRPC(method string, params []byte) (result []byte, err error)
+}
+
+// HandlerFunc adapts a function to Handler.
+type HandlerFunc func(method string, params []byte) ([]byte, error)
+
+func (f HandlerFunc) ServeRPC(method string, params []byte) ([]byte, error) {
+	return f(method, params)
+}
+
+// Error is an error response. Raw is the encoded error value as sent by
+// the peer; a Handler may return an *Error to choose it. Any other error
+// returned by a Handler is sent as its message string.
+type Error struct {
+	Raw []byte
+}
+
+func (e *Error) Error() string {
+	v, err := msgpraw.DecodeValue(&msgpraw.MsgpReader{Buff: e.Raw})
+	if err == nil && v.Kind() == msgpraw.KindStr {
+		return "msgprpc: remote error: " + v.Str()
+	}
+	return "msgprpc: remote error"
+}
+
+// Conn is one end of a MessagePack-RPC connection over rw. The protocol is
+// symmetric: both ends may call and both may serve, so a client is a Conn
+// whose Handler is nil and a server is a Conn that never calls.
+//
+// Serve must be running for calls to complete.
+type Conn struct {
+	rw      io.ReadWriter
+	handler Handler
+
+	wmu sync.Mutex // guards w and writes to rw
+	w   msgpraw.MsgpWriter
+
+	mu      sync.Mutex
+	nextID  uint32
+	pending map[uint32]chan result
+	err     error // set once Serve has stopped
+}
+
+type result struct {
+	msg Message
+	err error
+}
+
+// NewConn returns a connection over rw that passes incoming requests and
+// notifications to h. With a nil Handler, requests are answered with
+// ErrNoHandler and notifications are dropped.
+func NewConn(rw io.ReadWriter, h Handler) *Conn {
+	return &Conn{rw: rw, handler: h, pending: make(map[uint32]chan result)}
+}
+
+// Serve reads messages until the stream ends or fails, answering requests
+// and routing responses to their calls. Each request is handled in its own
+// goroutine. It returns nil at the end of the stream; pending and later
+// calls then fail with ErrClosed.
+func (c *Conn) Serve() error {
+	fr := msgpraw.NewFrameReader(c.rw, msgpraw.FrameSelfDelimiting)
+	err := c.serve(fr)
+	if err == io.EOF {
+		err = nil
+	}
+	c.mu.Lock()
+	c.err = ErrClosed
+	for id, ch := range c.pending {
+		delete(c.pending, id)
+		ch <- result{err: ErrClosed}
+	}
+	c.mu.Unlock()
+	return err
+}
+
+func (c *Conn) serve(fr *msgpraw.FrameReader) error {
+	for {
+		buf, err := fr.ReadFrame()
+		if err != nil {
+			return err
+		}
+		m, err := DecodeMessage(buf)
+		if err != nil {
+			return err
+		}
+		switch m.Type {
+		case Response:
+			c.mu.Lock()
+			ch := c.pending[m.ID]
+			delete(c.pending, m.ID)
+			c.mu.Unlock()
+			if ch != nil {
+				// buf is reused by the next ReadFrame.
+				m.Error = clone(m.Error)
+				m.Result = clone(m.Result)
+				ch <- result{msg: m}
+			}
+		case Request, Notification:
+			m.Params = clone(m.Params)
+			go c.handle(m)
+		}
+	}
+}
+
+func (c *Conn) handle(m Message) {
+	if c.handler == nil {
+		if m.Type == Request {
+			_ = c.send(&Message{Type: Response, ID: m.ID, Error: encodeError(ErrNoHandler)})
+		}
+		return
+	}
+	res, err := c.handler.ServeRPC(m.Method, m.Params)
+	if m.Type == Notification {
+		return
+	}
+	resp := Message{Type: Response, ID: m.ID, Result: res}
+	if err != nil {
+		resp.Result = nil
+		resp.Error = encodeError(err)
+	}
+	if c.send(&resp) == ErrInvalidMessage {
+		// The handler returned something that is not one encoded value.
+		_ = c.send(&Message{Type: Response, ID: m.ID, Error: encodeError(ErrInvalidMessage)})
+	}
+}
+
+func encodeError(err error) []byte {
+	var e *Error
+	if errors.As(err, &e) && len(e.Raw) > 0 {
+		return e.Raw
+	}
+	w := msgpraw.MsgpWriter{}
+	_ = w.WriteString(err.Error())
+	return w.Buff
+}
+
+// Call sends a request and waits for its response. params must be an
+// encoded array, or empty for no parameters. On success it returns the
+// encoded result; an error response is returned as an *Error.
+func (c *Conn) Call(ctx context.Context, method string, params []byte) ([]byte, error) {
+	ch := make(chan result, 1)
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, c.err
+	}
+	id := c.nextID
+	for c.pending[id] != nil {
+		id++
+	}
+	c.nextID = id + 1
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	if err := c.send(&Message{Type: Request, ID: id, Method: method, Params: params}); err != nil {
+		c.forget(id)
+		return nil, err
+	}
+	select {
+	case res := <-ch:
+		if res.err != nil {
+			return nil, res.err
+		}
+		if !IsNil(res.msg.Error) {
+			return nil, &Error{Raw: res.msg.Error}
+		}
+		return res.msg.Result, nil
+	case <-ctx.Done():
+		c.forget(id)
+		return nil, ctx.Err()
+	}
+}
+
+// Notify sends a notification; no response is expected.
+func (c *Conn) Notify(method string, params []byte) error {
+	c.mu.Lock()
+	err := c.err
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return c.send(&Message{Type: Notification, Method: method, Params: params})
+}
+
+func (c *Conn) forget(id uint32) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}
+
+// send writes m with a single Write so concurrent messages don't interleave.
+func (c *Conn) send(m *Message) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.w.Reset()
+	if err := m.Encode(&c.w); err != nil {
+		return err
+	}
+	_, err := c.rw.Write(c.w.Buff)
+	return err
+}
+
+func clone(b []byte) []byte {
+	return append([]byte(nil), b...)
+}
@@ -0,0 +1,165 @@
+package msgprpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/marino39/msgpraw"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// echo answers "echo" with its first parameter and fails everything else.
+var echo = HandlerFunc(func(method string, params []byte) ([]byte, error) {
+	if method != "echo" {
+		return nil, fmt.Errorf("unknown method %q", method)
+	}
+	r := msgpraw.MsgpReader{Buff: params}
+	if _, _, _, err := r.Read(); err != nil {
+		return nil, err
+	}
+	start := r.Idx
+	if err := r.SkipValue(); err != nil {
+		return nil, err
+	}
+	return params[start:r.Idx], nil
+})
+
+func pipe(t *testing.T, client, server Handler) (*Conn, *Conn) {
+	a, b := net.Pipe()
+	cc, sc := NewConn(a, client), NewConn(b, server)
+	go func() { _ = cc.Serve() }()
+	go func() { _ = sc.Serve() }()
+	t.Cleanup(func() {
+		a.Close()
+		b.Close()
+	})
+	return cc, sc
+}
+
+func TestConn_Call(t *testing.T) {
+	client, _ := pipe(t, nil, echo)
+	ctx := context.Background()
+
+	res, err := client.Call(ctx, "echo", encodeArgs(t, "hello"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0xa5, 'h', 'e', 'l', 'l', 'o'}, res)
+
+	_, err = client.Call(ctx, "nope", nil)
+	var rerr *Error
+	require.ErrorAs(t, err, &rerr)
+	assert.Equal(t, `msgprpc: remote error: unknown method "nope"`, err.Error())
+}
+
+func TestConn_Concurrent(t *testing.T) {
+	client, _ := pipe(t, nil, echo)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			arg := fmt.Sprint("call-", i)
+			res, err := client.Call(context.Background(), "echo", encodeArgs(t, arg))
+			if assert.NoError(t, err) {
+				assert.Equal(t, arg, string(res[1:]))
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestConn_Bidirectional(t *testing.T) {
+	got := make(chan string, 1)
+	// c2 calls back into c1 while serving a request, as Neovim does with
+	// its plugins.
+	a, b := net.Pipe()
+	t.Cleanup(func() {
+		a.Close()
+		b.Close()
+	})
+	c1 := NewConn(a, echo)
+	var c2 *Conn
+	c2 = NewConn(b, HandlerFunc(func(method string, params []byte) ([]byte, error) {
+		if method == "notify" {
+			got <- string(params[2:])
+			return nil, nil
+		}
+		return c2.Call(context.Background(), "echo", params)
+	}))
+	go func() { _ = c1.Serve() }()
+	go func() { _ = c2.Serve() }()
+
+	res, err := c1.Call(context.Background(), "relay", encodeArgs(t, "x"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0xa1, 'x'}, res)
+
+	require.NoError(t, c1.Notify("notify", encodeArgs(t, "n")))
+	select {
+	case s := <-got:
+		assert.Equal(t, "n", s)
+	case <-time.After(5 * time.Second):
+		t.Fatal("notification not delivered")
+	}
+}
+
+func TestConn_NoHandler(t *testing.T) {
+	client, _ := pipe(t, nil, nil)
+	_, err := client.Call(context.Background(), "echo", nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), ErrNoHandler.Error())
+}
+
+func TestConn_BadResult(t *testing.T) {
+	client, _ := pipe(t, nil, HandlerFunc(func(string, []byte) ([]byte, error) {
+		return []byte{0x01, 0x02}, nil
+	}))
+	_, err := client.Call(context.Background(), "m", nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), ErrInvalidMessage.Error())
+}
+
+func TestConn_Closed(t *testing.T) {
+	a, b := net.Pipe()
+	client := NewConn(a, nil)
+	done := make(chan error, 1)
+	go func() { done <- client.Serve() }()
+
+	block := make(chan struct{})
+	server := NewConn(b, HandlerFunc(func(string, []byte) ([]byte, error) {
+		<-block
+		return nil, nil
+	}))
+	go func() { _ = server.Serve() }()
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := client.Call(context.Background(), "wait", nil)
+		errc <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	b.Close()
+	close(block)
+
+	require.ErrorIs(t, <-errc, ErrClosed)
+	require.NoError(t, <-done)
+	_, err := client.Call(context.Background(), "x", nil)
+	require.ErrorIs(t, err, ErrClosed)
+	require.ErrorIs(t, client.Notify("x", nil), ErrClosed)
+	a.Close()
+}
+
+func TestConn_Cancel(t *testing.T) {
+	client, _ := pipe(t, nil, HandlerFunc(func(string, []byte) ([]byte, error) {
+		time.Sleep(200 * time.Millisecond)
+		return nil, nil
+	}))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := client.Call(ctx, "slow", nil)
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+}
@@ -0,0 +1,252 @@
+// Package msgprpc implements MessagePack-RPC on top of msgpraw.
+//
+// Messages are arrays on the wire:
+//
+//	request      [0, msgid, method, params]
+//	response     [1, msgid, error, result]
+//	notification [2, method, params]
+//
+// Params, Error and Result are kept as raw encoded values, so they are
+// neither decoded nor copied by this package.
+package msgprpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+
+	"github.com/marino39/msgpraw"
+)
+
+var ErrInvalidMessage = errors.New("msgprpc: invalid message")
+
+// MessageType is the first element of every message.
+type MessageType int
+
+const (
+	Request      MessageType = 0
+	Response     MessageType = 1
+	Notification MessageType = 2
+)
+
+// Message is a decoded envelope. Which fields are used depends on Type:
+// requests carry ID, Method and Params, responses ID, Error and Result, and
+// notifications Method and Params.
+type Message struct {
+	Type   MessageType
+	ID     uint32
+	Method string
+	// Params is an encoded array. An empty Params is written as an empty
+	// array.
+	Params []byte
+	// Error and Result are single encoded values. An empty one is written
+	// as nil.
+	Error  []byte
+	Result []byte
+}
+
+var (
+	encodedNil        = []byte{byte(msgpraw.Nil)}
+	encodedEmptyArray = []byte{byte(msgpraw.FixArray)}
+)
+
+// Encode appends m to w. Params, Error and Result must each hold exactly
+// one encoded value, otherwise ErrInvalidMessage is returned.
+func (m *Message) Encode(w *msgpraw.MsgpWriter) error {
+	switch m.Type {
+	case Request, Response:
+		if err := w.WriteArray(4); err != nil {
+			return err
+		}
+	case Notification:
+		if err := w.WriteArray(3); err != nil {
+			return err
+		}
+	default:
+		return ErrInvalidMessage
+	}
+	if err := w.WritePosFixInt(uint8(m.Type)); err != nil {
+		return err
+	}
+	if m.Type != Notification {
+		if err := writeUint(w, m.ID); err != nil {
+			return err
+		}
+	}
+	if m.Type == Response {
+		if err := writeRaw(w, m.Error, encodedNil); err != nil {
+			return err
+		}
+		return writeRaw(w, m.Result, encodedNil)
+	}
+	if err := w.WriteString(m.Method); err != nil {
+		return err
+	}
+	if len(m.Params) > 0 && !isArray(msgpraw.Type(m.Params[0])) {
+		return ErrInvalidMessage
+	}
+	return writeRaw(w, m.Params, encodedEmptyArray)
+}
+
+// writeUint writes u in its shortest format.
+func writeUint(w *msgpraw.MsgpWriter, u uint32) error {
+	switch {
+	case u <= uint32(msgpraw.PosFixIntMax):
+		return w.WritePosFixInt(uint8(u))
+	case u <= math.MaxUint8:
+		return w.WriteUint8(uint8(u))
+	case u <= math.MaxUint16:
+		return w.WriteUint16(uint16(u))
+	}
+	return w.WriteUint32(u)
+}
+
+// writeRaw appends raw, or empty if raw has no bytes. Anything but exactly
+// one value is ErrInvalidMessage, since it would corrupt the envelope.
+func writeRaw(w *msgpraw.MsgpWriter, raw, empty []byte) error {
+	if len(raw) == 0 {
+		raw = empty
+	}
+	if _, n, err := msgpraw.NextFrame(raw, msgpraw.FrameSelfDelimiting); err != nil || n != len(raw) {
+		return ErrInvalidMessage
+	}
+	w.Buff = append(w.Buff, raw...)
+	return nil
+}
+
+// DecodeMessage decodes the single message in buf. Params, Error and Result
+// are sub-slices of buf; Method is the only copy made, once it is known to be
+// a string.
+func DecodeMessage(buf []byte) (Message, error) {
+	var m Message
+	r := msgpraw.MsgpReader{Buff: buf}
+	t, n, _, err := r.Read()
+	if err != nil {
+		return m, err
+	}
+	if !isArray(t) || n < 3 || n > 4 {
+		return m, ErrInvalidMessage
+	}
+	typ, err := readUint(&r, math.MaxInt8)
+	if err != nil {
+		return m, err
+	}
+	m.Type = MessageType(typ)
+	switch {
+	case m.Type == Notification && n == 3:
+	case (m.Type == Request || m.Type == Response) && n == 4:
+		id, err := readUint(&r, math.MaxUint32)
+		if err != nil {
+			return m, err
+		}
+		m.ID = uint32(id)
+	default:
+		return m, ErrInvalidMessage
+	}
+
+	if m.Type == Response {
+		if m.Error, err = readRaw(&r); err != nil {
+			return m, err
+		}
+		if m.Result, err = readRaw(&r); err != nil {
+			return m, err
+		}
+	} else {
+		t, _, data, err := readElem(&r)
+		if err != nil {
+			return m, err
+		}
+		if !isStr(t) {
+			return m, ErrInvalidMessage
+		}
+		m.Method = string(data)
+		if m.Params, err = readRaw(&r); err != nil {
+			return m, err
+		}
+		if !isArray(msgpraw.Type(m.Params[0])) {
+			return m, ErrInvalidMessage
+		}
+	}
+	if r.Idx != len(buf) {
+		return m, ErrInvalidMessage
+	}
+	return m, nil
+}
+
+// IsNil reports whether raw is an encoded nil, as in the Error of a
+// successful response.
+func IsNil(raw []byte) bool {
+	return len(raw) == 1 && raw[0] == byte(msgpraw.Nil)
+}
+
+func isArray(t msgpraw.Type) bool {
+	return (t >= msgpraw.FixArray && t <= msgpraw.FixArrayMax) || t == msgpraw.Array16 || t == msgpraw.Array32
+}
+
+func isStr(t msgpraw.Type) bool {
+	return (t >= msgpraw.FixStr && t <= msgpraw.FixStrMax) || t == msgpraw.Str8 || t == msgpraw.Str16 || t == msgpraw.Str32
+}
+
+// readUint reads a non-negative integer no greater than max. Anything else,
+// including a container, is rejected from its header alone.
+func readUint(r *msgpraw.MsgpReader, max uint64) (uint64, error) {
+	t, _, data, err := readElem(r)
+	if err != nil {
+		return 0, err
+	}
+	var u uint64
+	negative := false
+	switch t {
+	case msgpraw.Uint8:
+		u = uint64(data[0])
+	case msgpraw.Uint16:
+		u = uint64(binary.BigEndian.Uint16(data))
+	case msgpraw.Uint32:
+		u = uint64(binary.BigEndian.Uint32(data))
+	case msgpraw.Uint64:
+		u = binary.BigEndian.Uint64(data)
+	case msgpraw.Int8:
+		i := int8(data[0])
+		negative, u = i < 0, uint64(i)
+	case msgpraw.Int16:
+		i := int16(binary.BigEndian.Uint16(data))
+		negative, u = i < 0, uint64(i)
+	case msgpraw.Int32:
+		i := int32(binary.BigEndian.Uint32(data))
+		negative, u = i < 0, uint64(i)
+	case msgpraw.Int64:
+		i := int64(binary.BigEndian.Uint64(data))
+		negative, u = i < 0, uint64(i)
+	default:
+		if t > msgpraw.PosFixIntMax {
+			return 0, ErrInvalidMessage
+		}
+		u = uint64(t)
+	}
+	if negative || u > max {
+		return 0, ErrInvalidMessage
+	}
+	return u, nil
+}
+
+// readElem reads the next element's header of the envelope; running out of
+// input is ErrTruncated since the envelope header promised more.
+func readElem(r *msgpraw.MsgpReader) (msgpraw.Type, int, []byte, error) {
+	t, n, data, err := r.Read()
+	if err == msgpraw.EOF {
+		err = msgpraw.ErrTruncated
+	}
+	return t, n, data, err
+}
+
+func readRaw(r *msgpraw.MsgpReader) ([]byte, error) {
+	start := r.Idx
+	err := r.SkipValue()
+	if err == msgpraw.EOF {
+		err = msgpraw.ErrTruncated
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.Buff[start:r.Idx], nil
+}
@@ -0,0 +1,101 @@
+package msgprpc
+
+import (
+	"testing"
+
+	"github.com/marino39/msgpraw"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func encodeArgs(t *testing.T, args ...string) []byte {
+	w := &msgpraw.MsgpWriter{}
+	require.NoError(t, w.WriteArray(len(args)))
+	for _, a := range args {
+		require.NoError(t, w.WriteString(a))
+	}
+	return w.Buff
+}
+
+func TestMessage_RoundTrip(t *testing.T) {
+	params := encodeArgs(t, "a", "b")
+	result := []byte{0x2a}
+	errStr := encodeArgs(t)[:0]
+	errStr = append(errStr, 0xa3, 'b', 'a', 'd')
+
+	for _, m := range []Message{
+		{Type: Request, ID: 7, Method: "nvim_command", Params: params},
+		{Type: Request, ID: 1<<32 - 1, Method: "ping", Params: []byte{byte(msgpraw.FixArray)}},
+		{Type: Response, ID: 7, Error: []byte{byte(msgpraw.Nil)}, Result: result},
+		{Type: Response, ID: 8, Error: errStr, Result: []byte{byte(msgpraw.Nil)}},
+		{Type: Notification, Method: "redraw", Params: params},
+	} {
+		w := &msgpraw.MsgpWriter{}
+		require.NoError(t, m.Encode(w))
+		got, err := DecodeMessage(w.Buff)
+		require.NoError(t, err)
+		assert.Equal(t, m, got)
+	}
+}
+
+func TestMessage_Defaults(t *testing.T) {
+	w := &msgpraw.MsgpWriter{}
+	require.NoError(t, (&Message{Type: Request, ID: 1, Method: "m"}).Encode(w))
+	assert.Equal(t, []byte{0x94, 0x00, 0x01, 0xa1, 'm', 0x90}, w.Buff)
+
+	w.Reset()
+	require.NoError(t, (&Message{Type: Response, ID: 1}).Encode(w))
+	assert.Equal(t, []byte{0x94, 0x01, 0x01, 0xc0, 0xc0}, w.Buff)
+}
+
+func TestMessage_Invalid(t *testing.T) {
+	w := &msgpraw.MsgpWriter{}
+	assert.ErrorIs(t, (&Message{Type: 3}).Encode(w), ErrInvalidMessage)
+	assert.ErrorIs(t, (&Message{Type: Request, Params: []byte{0x01}}).Encode(w), ErrInvalidMessage)
+	assert.ErrorIs(t, (&Message{Type: Response, Result: []byte{0x01, 0x02}}).Encode(w), ErrInvalidMessage)
+
+	for name, buf := range map[string][]byte{
+		"not an array":       {0x01},
+		"too short":          {0x92, 0x00, 0x01},
+		"unknown type":       {0x94, 0x05, 0x01, 0xa1, 'm', 0x90},
+		"notification len 4": {0x94, 0x02, 0x01, 0xa1, 'm', 0x90},
+		"request len 3":      {0x93, 0x00, 0xa1, 'm', 0x90},
+		"negative id":        {0x94, 0x00, 0xff, 0xa1, 'm', 0x90},
+		"negative int8 id":   {0x94, 0x00, 0xd0, 0xff, 0xa1, 'm', 0x90},
+		"id too large":       {0x94, 0x00, 0xcf, 0, 0, 0, 1, 0, 0, 0, 0, 0xa1, 'm', 0x90},
+		"method not str":     {0x94, 0x00, 0x01, 0x01, 0x90},
+		"params not array":   {0x94, 0x00, 0x01, 0xa1, 'm', 0x80},
+		"trailing data":      {0x94, 0x01, 0x01, 0xc0, 0xc0, 0xc0},
+	} {
+		_, err := DecodeMessage(buf)
+		assert.ErrorIs(t, err, ErrInvalidMessage, name)
+	}
+
+	_, err := DecodeMessage([]byte{0x94, 0x00, 0x01, 0xa1, 'm'})
+	assert.ErrorIs(t, err, msgpraw.ErrTruncated)
+}
+
+func TestMessage_DecodeSignedID(t *testing.T) {
+	m, err := DecodeMessage([]byte{0x94, 0x00, 0xd1, 0x01, 0x00, 0xa1, 'm', 0x90})
+	require.NoError(t, err)
+	assert.Equal(t, uint32(256), m.ID)
+}
+
+func TestMessage_HostileMethodNoAllocs(t *testing.T) {
+	// A method that is a large array is rejected from its header, without
+	// decoding the array.
+	w := &msgpraw.MsgpWriter{}
+	require.NoError(t, w.WriteArray(4))
+	require.NoError(t, w.WritePosFixInt(0))
+	require.NoError(t, w.WritePosFixInt(1))
+	require.NoError(t, w.WriteArray(1<<16))
+	for i := 0; i < 1<<16; i++ {
+		require.NoError(t, w.WriteString("x"))
+	}
+	require.NoError(t, w.WriteArray(0))
+	allocs := testing.AllocsPerRun(10, func() {
+		_, err := DecodeMessage(w.Buff)
+		assert.ErrorIs(t, err, ErrInvalidMessage)
+	})
+	assert.Zero(t, allocs)
+}
@@ -0,0 +1,48 @@
+package msgpraw
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// intPayload decodes an integer-family value from the tag and payload returned
+// by Read. For the Uint* formats isUint is true and v holds the bits of the
+// unsigned value; callers convert with uint64(v). ok is false when t is not an
+// integer format.
+func intPayload(t Type, data []byte) (v int64, isUint bool, ok bool) {
+	switch {
+	case t <= PosFixIntMax:
+		return int64(t), false, true
+	case t >= NegFixInt:
+		return int64(int8(t)), false, true
+	case t == Int8:
+		return int64(int8(data[0])), false, true
+	case t == Int16:
+		return int64(int16(binary.BigEndian.Uint16(data))), false, true
+	case t == Int32:
+		return int64(int32(binary.BigEndian.Uint32(data))), false, true
+	case t == Int64:
+		return int64(binary.BigEndian.Uint64(data)), false, true
+	case t == Uint8:
+		return int64(data[0]), true, true
+	case t == Uint16:
+		return int64(binary.BigEndian.Uint16(data)), true, true
+	case t == Uint32:
+		return int64(binary.BigEndian.Uint32(data)), true, true
+	case t == Uint64:
+		return int64(binary.BigEndian.Uint64(data)), true, true
+	}
+	return 0, false, false
+}
+
+// floatPayload decodes a Float32 or Float64 payload. ok is false for any other
+// format.
+func floatPayload(t Type, data []byte) (float64, bool) {
+	switch t {
+	case Float32:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data))), true
+	case Float64:
+		return math.Float64frombits(binary.BigEndian.Uint64(data)), true
+	}
+	return 0, false
+}
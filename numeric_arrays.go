@@ -0,0 +1,224 @@
+package msgpraw
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// The batched array writers emit the array header followed by every element
+// in the fixed format of its Go type (WriteFloat64Array writes Float64
+// elements, WriteInt32Array Int32 elements, ...), growing Buff once up front.
+
+func (w *MsgpWriter) WriteFloat64Array(s []float64) error {
+	if err := w.beginNumericArray(len(s), 9); err != nil {
+		return err
+	}
+	for _, f := range s {
+		w.Buff = append(w.Buff, byte(Float64))
+		w.Buff = binary.BigEndian.AppendUint64(w.Buff, math.Float64bits(f))
+	}
+	return nil
+}
+
+func (w *MsgpWriter) WriteFloat32Array(s []float32) error {
+	if err := w.beginNumericArray(len(s), 5); err != nil {
+		return err
+	}
+	for _, f := range s {
+		w.Buff = append(w.Buff, byte(Float32))
+		w.Buff = binary.BigEndian.AppendUint32(w.Buff, math.Float32bits(f))
+	}
+	return nil
+}
+
+func (w *MsgpWriter) WriteInt64Array(s []int64) error {
+	if err := w.beginNumericArray(len(s), 9); err != nil {
+		return err
+	}
+	for _, i := range s {
+		w.Buff = append(w.Buff, byte(Int64))
+		w.Buff = binary.BigEndian.AppendUint64(w.Buff, uint64(i))
+	}
+	return nil
+}
+
+func (w *MsgpWriter) WriteInt32Array(s []int32) error {
+	if err := w.beginNumericArray(len(s), 5); err != nil {
+		return err
+	}
+	for _, i := range s {
+		w.Buff = append(w.Buff, byte(Int32))
+		w.Buff = binary.BigEndian.AppendUint32(w.Buff, uint32(i))
+	}
+	return nil
+}
+
+func (w *MsgpWriter) WriteInt16Array(s []int16) error {
+	if err := w.beginNumericArray(len(s), 3); err != nil {
+		return err
+	}
+	for _, i := range s {
+		w.Buff = append(w.Buff, byte(Int16))
+		w.Buff = binary.BigEndian.AppendUint16(w.Buff, uint16(i))
+	}
+	return nil
+}
+
+func (w *MsgpWriter) WriteUint64Array(s []uint64) error {
+	if err := w.beginNumericArray(len(s), 9); err != nil {
+		return err
+	}
+	for _, u := range s {
+		w.Buff = append(w.Buff, byte(Uint64))
+		w.Buff = binary.BigEndian.AppendUint64(w.Buff, u)
+	}
+	return nil
+}
+
+func (w *MsgpWriter) WriteUint32Array(s []uint32) error {
+	if err := w.beginNumericArray(len(s), 5); err != nil {
+		return err
+	}
+	for _, u := range s {
+		w.Buff = append(w.Buff, byte(Uint32))
+		w.Buff = binary.BigEndian.AppendUint32(w.Buff, u)
+	}
+	return nil
+}
+
+func (w *MsgpWriter) WriteUint16Array(s []uint16) error {
+	if err := w.beginNumericArray(len(s), 3); err != nil {
+		return err
+	}
+	for _, u := range s {
+		w.Buff = append(w.Buff, byte(Uint16))
+		w.Buff = binary.BigEndian.AppendUint16(w.Buff, u)
+	}
+	return nil
+}
+
+// beginNumericArray makes room for an array of n elements of elemSize bytes
+// each and writes its header.
+func (w *MsgpWriter) beginNumericArray(n, elemSize int) error {
+	if uint64(n) > maxUint32 {
+		return ErrArrayTooLong
+	}
+	if need := 5 + n*elemSize; cap(w.Buff)-len(w.Buff) < need {
+		// Grow like append does, so that many small arrays stay linear.
+		w.Buff = append(w.Buff, make([]byte, need)...)[:len(w.Buff)]
+	}
+	return w.WriteArray(n)
+}
+
+// The batched array readers read an array of numbers and append its elements
+// to dst, returning the extended slice. Elements may use any format of the
+// matching family: the integer readers accept every integer format whose
+// value fits the element type (ErrIntOverflow otherwise), the float readers
+// accept Float32 and Float64, the latter only if ReadFloat32Array can
+// convert it exactly. Any other element is ErrTypeMismatch. On error Idx is
+// left at the start of the array and dst is returned at its original length.
+
+func (r *MsgpReader) ReadFloat64Array(dst []float64) ([]float64, error) {
+	return readFloatArray(r, dst)
+}
+
+func (r *MsgpReader) ReadFloat32Array(dst []float32) ([]float32, error) {
+	return readFloatArray(r, dst)
+}
+
+func (r *MsgpReader) ReadInt64Array(dst []int64) ([]int64, error) {
+	return readIntArray(r, dst)
+}
+
+func (r *MsgpReader) ReadInt32Array(dst []int32) ([]int32, error) {
+	return readIntArray(r, dst)
+}
+
+func (r *MsgpReader) ReadInt16Array(dst []int16) ([]int16, error) {
+	return readIntArray(r, dst)
+}
+
+func (r *MsgpReader) ReadUint64Array(dst []uint64) ([]uint64, error) {
+	return readUintArray(r, dst)
+}
+
+func (r *MsgpReader) ReadUint32Array(dst []uint32) ([]uint32, error) {
+	return readUintArray(r, dst)
+}
+
+func (r *MsgpReader) ReadUint16Array(dst []uint16) ([]uint16, error) {
+	return readUintArray(r, dst)
+}
+
+func readIntArray[T int16 | int32 | int64](r *MsgpReader, dst []T) ([]T, error) {
+	return readNumericArray(r, dst, func(t Type, data []byte) (T, error) {
+		v, isUint, ok := intPayload(t, data)
+		if !ok {
+			return 0, ErrTypeMismatch
+		}
+		if (isUint && v < 0) || int64(T(v)) != v {
+			return 0, ErrIntOverflow
+		}
+		return T(v), nil
+	})
+}
+
+func readUintArray[T uint16 | uint32 | uint64](r *MsgpReader, dst []T) ([]T, error) {
+	return readNumericArray(r, dst, func(t Type, data []byte) (T, error) {
+		v, isUint, ok := intPayload(t, data)
+		if !ok {
+			return 0, ErrTypeMismatch
+		}
+		if (!isUint && v < 0) || uint64(T(v)) != uint64(v) {
+			return 0, ErrIntOverflow
+		}
+		return T(v), nil
+	})
+}
+
+func readFloatArray[T float32 | float64](r *MsgpReader, dst []T) ([]T, error) {
+	return readNumericArray(r, dst, func(t Type, data []byte) (T, error) {
+		f, ok := floatPayload(t, data)
+		if !ok || (float64(T(f)) != f && !math.IsNaN(f)) {
+			return 0, ErrTypeMismatch
+		}
+		return T(f), nil
+	})
+}
+
+func readNumericArray[T any](r *MsgpReader, dst []T, elem func(Type, []byte) (T, error)) ([]T, error) {
+	start, orig := r.Idx, len(dst)
+	fail := func(err error) ([]T, error) {
+		if err == EOF && r.Idx > start {
+			err = ErrTruncated
+		}
+		r.Idx = start
+		return dst[:orig], err
+	}
+
+	t, n, _, err := r.Read()
+	if err != nil {
+		return fail(err)
+	}
+	if !t.isArray() {
+		return fail(ErrTypeMismatch)
+	}
+	if n > len(r.Buff)-r.Idx {
+		return fail(ErrTruncated)
+	}
+	if cap(dst)-len(dst) < n {
+		dst = append(dst, make([]T, n)...)[:len(dst)]
+	}
+	for i := 0; i < n; i++ {
+		t, _, data, err := r.Read()
+		if err != nil {
+			return fail(err)
+		}
+		v, err := elem(t, data)
+		if err != nil {
+			return fail(err)
+		}
+		dst = append(dst, v)
+	}
+	return dst, nil
+}
@@ -0,0 +1,218 @@
+package msgpraw
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNumericArrays_RoundTrip(t *testing.T) {
+	w := &MsgpWriter{}
+	f64 := []float64{0, -1.5, math.MaxFloat64, math.Inf(1)}
+	f32 := []float32{1.25, -math.MaxFloat32}
+	i64 := []int64{math.MinInt64, -1, 0, math.MaxInt64}
+	i32 := []int32{math.MinInt32, 7}
+	i16 := []int16{math.MinInt16, math.MaxInt16}
+	u64 := []uint64{0, math.MaxUint64}
+	u32 := []uint32{math.MaxUint32}
+	u16 := make([]uint16, 20)
+	for i := range u16 {
+		u16[i] = uint16(i * 1000)
+	}
+	require.NoError(t, w.WriteFloat64Array(f64))
+	require.NoError(t, w.WriteFloat32Array(f32))
+	require.NoError(t, w.WriteInt64Array(i64))
+	require.NoError(t, w.WriteInt32Array(i32))
+	require.NoError(t, w.WriteInt16Array(i16))
+	require.NoError(t, w.WriteUint64Array(u64))
+	require.NoError(t, w.WriteUint32Array(u32))
+	require.NoError(t, w.WriteUint16Array(u16))
+	require.NoError(t, w.WriteInt64Array(nil))
+
+	r := &MsgpReader{Buff: w.Buff}
+	gf64, err := r.ReadFloat64Array(nil)
+	require.NoError(t, err)
+	assert.Equal(t, f64, gf64)
+	gf32, err := r.ReadFloat32Array(nil)
+	require.NoError(t, err)
+	assert.Equal(t, f32, gf32)
+	gi64, err := r.ReadInt64Array(nil)
+	require.NoError(t, err)
+	assert.Equal(t, i64, gi64)
+	gi32, err := r.ReadInt32Array(nil)
+	require.NoError(t, err)
+	assert.Equal(t, i32, gi32)
+	gi16, err := r.ReadInt16Array(nil)
+	require.NoError(t, err)
+	assert.Equal(t, i16, gi16)
+	gu64, err := r.ReadUint64Array(nil)
+	require.NoError(t, err)
+	assert.Equal(t, u64, gu64)
+	gu32, err := r.ReadUint32Array(nil)
+	require.NoError(t, err)
+	assert.Equal(t, u32, gu32)
+	gu16, err := r.ReadUint16Array(nil)
+	require.NoError(t, err)
+	assert.Equal(t, u16, gu16)
+	empty, err := r.ReadInt64Array(nil)
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+	assert.Equal(t, len(w.Buff), r.Idx)
+}
+
+func TestNumericArrays_MatchesPerElementWrites(t *testing.T) {
+	s := []int32{1, -2, 3}
+	batched := &MsgpWriter{}
+	require.NoError(t, batched.WriteInt32Array(s))
+
+	single := &MsgpWriter{}
+	require.NoError(t, single.WriteArray(len(s)))
+	for _, v := range s {
+		require.NoError(t, single.WriteInt32(v))
+	}
+	assert.Equal(t, single.Buff, batched.Buff)
+}
+
+func TestNumericArrays_Growth(t *testing.T) {
+	w := &MsgpWriter{Buff: []byte{byte(Nil)}}
+	require.NoError(t, w.WriteFloat64Array(make([]float64, 1000)))
+	assert.Equal(t, 1+3+1000*9, len(w.Buff))
+	assert.GreaterOrEqual(t, cap(w.Buff), 1+5+1000*9)
+
+	// Many small arrays must not reallocate Buff on every call.
+	w = &MsgpWriter{}
+	var dst []int64
+	grows := 0
+	for i := 0; i < 10000; i++ {
+		c := cap(w.Buff)
+		require.NoError(t, w.WriteFloat64Array([]float64{1, 2, 3, 4}))
+		if cap(w.Buff) != c {
+			grows++
+		}
+	}
+	assert.Less(t, grows, 40)
+
+	w = &MsgpWriter{}
+	require.NoError(t, w.WriteInt64Array([]int64{1, 2, 3, 4}))
+	grows = 0
+	for i := 0; i < 10000; i++ {
+		c := cap(dst)
+		r := MsgpReader{Buff: w.Buff}
+		var err error
+		dst, err = r.ReadInt64Array(dst)
+		require.NoError(t, err)
+		if cap(dst) != c {
+			grows++
+		}
+	}
+	assert.Len(t, dst, 40000)
+	assert.Less(t, grows, 40)
+}
+
+func TestNumericArrays_MixedFormats(t *testing.T) {
+	w := &MsgpWriter{}
+	require.NoError(t, w.WriteArray(4))
+	require.NoError(t, w.WritePosFixInt(1))
+	require.NoError(t, w.WriteNegFixInt(-1))
+	require.NoError(t, w.WriteUint8(200))
+	require.NoError(t, w.WriteInt32(-70000))
+
+	dst := make([]int64, 1, 8)
+	got, err := (&MsgpReader{Buff: w.Buff}).ReadInt64Array(dst)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{0, 1, -1, 200, -70000}, got)
+	assert.Equal(t, &dst[0], &got[0], "dst capacity is reused")
+
+	w = &MsgpWriter{}
+	require.NoError(t, w.WriteArray(2))
+	require.NoError(t, w.WriteFloat32(0.5))
+	require.NoError(t, w.WriteFloat64(0.25))
+	f, err := (&MsgpReader{Buff: w.Buff}).ReadFloat32Array(nil)
+	require.NoError(t, err)
+	assert.Equal(t, []float32{0.5, 0.25}, f)
+}
+
+func TestNumericArrays_Errors(t *testing.T) {
+	build := func(fn func(w *MsgpWriter)) []byte {
+		w := &MsgpWriter{}
+		fn(w)
+		return w.Buff
+	}
+	cases := []struct {
+		name string
+		buf  []byte
+		read func(r *MsgpReader) error
+		err  error
+	}{
+		{"not_array", build(func(w *MsgpWriter) { _ = w.WriteNil() }),
+			func(r *MsgpReader) error { _, err := r.ReadInt64Array(nil); return err }, ErrTypeMismatch},
+		{"string_elem", build(func(w *MsgpWriter) { _ = w.WriteArray(1); _ = w.WriteString("x") }),
+			func(r *MsgpReader) error { _, err := r.ReadInt64Array(nil); return err }, ErrTypeMismatch},
+		{"int16_overflow", build(func(w *MsgpWriter) { _ = w.WriteArray(1); _ = w.WriteInt32(40000) }),
+			func(r *MsgpReader) error { _, err := r.ReadInt16Array(nil); return err }, ErrIntOverflow},
+		{"negative_uint", build(func(w *MsgpWriter) { _ = w.WriteArray(1); _ = w.WriteNegFixInt(-1) }),
+			func(r *MsgpReader) error { _, err := r.ReadUint64Array(nil); return err }, ErrIntOverflow},
+		{"uint64_to_int64", build(func(w *MsgpWriter) { _ = w.WriteArray(1); _ = w.WriteUint64(math.MaxUint64) }),
+			func(r *MsgpReader) error { _, err := r.ReadInt64Array(nil); return err }, ErrIntOverflow},
+		{"inexact_float32", build(func(w *MsgpWriter) { _ = w.WriteArray(1); _ = w.WriteFloat64(0.1) }),
+			func(r *MsgpReader) error { _, err := r.ReadFloat32Array(nil); return err }, ErrTypeMismatch},
+		{"int_as_float", build(func(w *MsgpWriter) { _ = w.WriteArray(1); _ = w.WritePosFixInt(1) }),
+			func(r *MsgpReader) error { _, err := r.ReadFloat64Array(nil); return err }, ErrTypeMismatch},
+		{"truncated", []byte{byte(FixArray) | 2, byte(Int8), 1},
+			func(r *MsgpReader) error { _, err := r.ReadInt64Array(nil); return err }, ErrTruncated},
+		{"huge_count", []byte{byte(Array32), 0xff, 0xff, 0xff, 0xff, 0x01},
+			func(r *MsgpReader) error { _, err := r.ReadInt64Array(nil); return err }, ErrTruncated},
+		{"empty", nil,
+			func(r *MsgpReader) error { _, err := r.ReadInt64Array(nil); return err }, EOF},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &MsgpReader{Buff: tc.buf}
+			require.ErrorIs(t, tc.read(r), tc.err)
+			assert.Equal(t, 0, r.Idx)
+		})
+	}
+}
+
+func TestNumericArrays_NoAllocs(t *testing.T) {
+	src := make([]float64, 256)
+	w := &MsgpWriter{Buff: make([]byte, 0, 4096)}
+	dst := make([]float64, 0, len(src))
+	allocs := testing.AllocsPerRun(100, func() {
+		w.Reset()
+		_ = w.WriteFloat64Array(src)
+		r := MsgpReader{Buff: w.Buff}
+		dst, _ = r.ReadFloat64Array(dst[:0])
+	})
+	require.Zero(t, allocs)
+}
+
+func BenchmarkWriteFloat64Array(b *testing.B) {
+	src := make([]float64, 1<<16)
+	for i := range src {
+		src[i] = float64(i) * 0.5
+	}
+	w := &MsgpWriter{Buff: make([]byte, 0, 5+9*len(src))}
+	b.SetBytes(int64(9 * len(src)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w.Reset()
+		_ = w.WriteFloat64Array(src)
+	}
+}
+
+func BenchmarkReadFloat64Array(b *testing.B) {
+	w := &MsgpWriter{}
+	_ = w.WriteFloat64Array(make([]float64, 1<<16))
+	dst := make([]float64, 0, 1<<16)
+	b.SetBytes(int64(len(w.Buff)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r := MsgpReader{Buff: w.Buff}
+		dst, _ = r.ReadFloat64Array(dst[:0])
+	}
+}
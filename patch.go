@@ -0,0 +1,254 @@
+package msgpraw
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+var (
+	ErrInvalidPath  = errors.New("msgpraw: path must be an array of string and integer steps")
+	ErrInvalidValue = errors.New("msgpraw: not exactly one msgpack value")
+	ErrMapFull      = errors.New("msgpraw: map already holds the maximum number of pairs")
+)
+
+// Replace returns a copy of buf with the value at path replaced by newValue,
+// which must hold exactly one encoded value. Only the replaced bytes change;
+// the rest of buf is copied verbatim and buf itself is left untouched.
+//
+// path is an encoded array of steps. A string step selects a map key; an
+// integer step selects an array element, or an integer map key matched by
+// numeric value. The empty array is the top-level value:
+//
+//	["user", "trace_id"]  →  buf.user.trace_id
+//	["items", 3, "id"]    →  buf.items[3].id
+func Replace(buf, path, newValue []byte) ([]byte, error) {
+	steps, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSingleValue(newValue); err != nil {
+		return nil, err
+	}
+	start, err := locate(buf, steps)
+	if err != nil {
+		return nil, err
+	}
+	end, err := valueEnd(buf, start)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(buf)-(end-start)+len(newValue))
+	out = append(out, buf[:start]...)
+	out = append(out, newValue...)
+	return append(out, buf[end:]...), nil
+}
+
+// Delete returns a copy of buf without the map entry at path (see Replace),
+// whose last step is the key to remove. Besides the removed pair only the
+// count in the map header changes; the header keeps its width.
+func Delete(buf, path []byte) ([]byte, error) {
+	steps, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(steps) == 0 {
+		return nil, ErrInvalidPath
+	}
+	mapStart, err := locate(buf, steps[:len(steps)-1])
+	if err != nil {
+		return nil, err
+	}
+	r := MsgpReader{Buff: buf, Idx: mapStart}
+	keyStart, err := r.findKey(steps[len(steps)-1].matches)
+	if err != nil {
+		return nil, err
+	}
+	valEnd, err := valueEnd(buf, r.Idx)
+	if err != nil {
+		return nil, err
+	}
+	t, n, _, _ := (&MsgpReader{Buff: buf, Idx: mapStart}).Read()
+	out := make([]byte, 0, len(buf)-(valEnd-keyStart))
+	out = append(out, buf[:mapStart]...)
+	out = appendMapHeader(out, t, n-1)
+	out = append(out, buf[mapStart+mapHeaderLen(t):keyStart]...)
+	return append(out, buf[valEnd:]...), nil
+}
+
+// Insert returns a copy of buf with a new entry appended to a map. The last
+// step of path (see Replace) is the new key and the steps before it lead to
+// the map; a key that is already present is ErrDuplicateKey. The map header
+// is promoted from FixMap to Map16 or from Map16 to Map32 when the new count
+// needs it.
+func Insert(buf, path, newValue []byte) ([]byte, error) {
+	steps, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(steps) == 0 {
+		return nil, ErrInvalidPath
+	}
+	if err := checkSingleValue(newValue); err != nil {
+		return nil, err
+	}
+	mapStart, err := locate(buf, steps[:len(steps)-1])
+	if err != nil {
+		return nil, err
+	}
+	key := steps[len(steps)-1]
+	r := MsgpReader{Buff: buf, Idx: mapStart}
+	switch _, err := r.findKey(key.matches); err {
+	case nil:
+		return nil, ErrDuplicateKey
+	case ErrNotFound:
+	default:
+		return nil, err
+	}
+	mapEnd, err := valueEnd(buf, mapStart)
+	if err != nil {
+		return nil, err
+	}
+	t, n, _, _ := r.Read()
+	if uint64(n) >= maxUint32 {
+		return nil, ErrMapFull
+	}
+	out := make([]byte, 0, len(buf)+4+len(key.raw)+len(newValue))
+	out = append(out, buf[:mapStart]...)
+	out = appendMapHeader(out, t, n+1)
+	out = append(out, buf[mapStart+mapHeaderLen(t):mapEnd]...)
+	out = append(out, key.raw...)
+	out = append(out, newValue...)
+	return append(out, buf[mapEnd:]...), nil
+}
+
+// pathStep is one decoded step of a path.
+type pathStep struct {
+	raw    []byte // the step's encoding, reused as the key by Insert
+	str    []byte // string steps: the payload
+	isStr  bool
+	i      int64 // integer steps: the value, as returned by intPayload
+	isUint bool
+}
+
+func parsePath(path []byte) ([]pathStep, error) {
+	r := MsgpReader{Buff: path}
+	n, err := r.openContainer(Type.isArray)
+	if err != nil || n > len(path) {
+		return nil, ErrInvalidPath
+	}
+	steps := make([]pathStep, n)
+	for i := range steps {
+		start := r.Idx
+		t, _, data, err := r.Read()
+		if err != nil {
+			return nil, ErrInvalidPath
+		}
+		s := &steps[i]
+		s.raw = path[start:r.Idx]
+		if t.isStr() {
+			s.str, s.isStr = data, true
+			continue
+		}
+		var ok bool
+		if s.i, s.isUint, ok = intPayload(t, data); !ok {
+			return nil, ErrInvalidPath
+		}
+	}
+	if r.Idx != len(path) {
+		return nil, ErrInvalidPath
+	}
+	return steps, nil
+}
+
+// matches reports whether the map key with tag t and payload data is s.
+func (s pathStep) matches(t Type, data []byte) bool {
+	if s.isStr {
+		return t.isStr() && bytes.Equal(data, s.str)
+	}
+	v, isUint, ok := intPayload(t, data)
+	return ok && v == s.i && (isUint == s.isUint || v >= 0)
+}
+
+// locate returns the offset of the value at steps.
+func locate(buf []byte, steps []pathStep) (int, error) {
+	r := MsgpReader{Buff: buf}
+	for _, s := range steps {
+		start := r.Idx
+		t, n, _, err := r.Read()
+		if err == EOF {
+			err = ErrTruncated
+		}
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case t.isMap():
+			r.Idx = start
+			if _, err := r.findKey(s.matches); err != nil {
+				return 0, err
+			}
+		case t.isArray():
+			if s.isStr {
+				return 0, ErrTypeMismatch
+			}
+			// A Uint64 step above math.MaxInt64 has a negative s.i.
+			if s.i < 0 || s.i >= int64(n) {
+				return 0, ErrIndexRange
+			}
+			for i := int64(0); i < s.i; i++ {
+				if err := r.SkipValue(); err != nil {
+					if err == EOF {
+						err = ErrTruncated
+					}
+					return 0, err
+				}
+			}
+		default:
+			return 0, ErrTypeMismatch
+		}
+	}
+	return r.Idx, nil
+}
+
+// valueEnd returns the offset just past the value starting at off.
+func valueEnd(buf []byte, off int) (int, error) {
+	r := MsgpReader{Buff: buf}
+	if err := r.skipFrom(off); err != nil {
+		return 0, err
+	}
+	return r.Idx, nil
+}
+
+func checkSingleValue(v []byte) error {
+	r := MsgpReader{Buff: v}
+	if err := r.SkipValue(); err != nil || r.Idx != len(v) {
+		return ErrInvalidValue
+	}
+	return nil
+}
+
+func mapHeaderLen(t Type) int {
+	switch t {
+	case Map16:
+		return 3
+	case Map32:
+		return 5
+	}
+	return 1
+}
+
+// appendMapHeader appends a header for n pairs at least as wide as the
+// original header t.
+func appendMapHeader(out []byte, t Type, n int) []byte {
+	switch {
+	case t != Map16 && t != Map32 && n <= 15:
+		return append(out, byte(FixMap)|byte(n))
+	case t != Map32 && n <= maxUint16:
+		out = append(out, byte(Map16))
+		return binary.BigEndian.AppendUint16(out, uint16(n))
+	default:
+		out = append(out, byte(Map32))
+		return binary.BigEndian.AppendUint32(out, uint32(n))
+	}
+}
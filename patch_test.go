@@ -0,0 +1,191 @@
+package msgpraw
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// encodePath encodes string and int steps as a path array.
+func encodePath(t *testing.T, steps ...any) []byte {
+	w := &MsgpWriter{}
+	require.NoError(t, w.WriteArray(len(steps)))
+	for _, s := range steps {
+		switch s := s.(type) {
+		case string:
+			require.NoError(t, w.WriteString(s))
+		case int:
+			require.NoError(t, EncodeValue(w, IntValue(int64(s))))
+		}
+	}
+	return w.Buff
+}
+
+func encodeValue(t *testing.T, v Value) []byte {
+	w := &MsgpWriter{}
+	require.NoError(t, EncodeValue(w, v))
+	return w.Buff
+}
+
+func mustMap(t *testing.T, kv ...Value) Value {
+	m, err := MapValue(kv...)
+	require.NoError(t, err)
+	return m
+}
+
+// patchFixture is {"trace": "abc", "items": [{"id": 1}, {"id": 2}], 7: "seven"}.
+func patchFixture(t *testing.T) []byte {
+	return encodeValue(t, mustMap(t,
+		StrValue("trace"), StrValue("abc"),
+		StrValue("items"), ArrayValue(
+			mustMap(t, StrValue("id"), IntValue(1)),
+			mustMap(t, StrValue("id"), IntValue(2)),
+		),
+		IntValue(7), StrValue("seven"),
+	))
+}
+
+func TestReplace(t *testing.T) {
+	buf := patchFixture(t)
+	orig := append([]byte(nil), buf...)
+
+	out, err := Replace(buf, encodePath(t, "trace"), encodeValue(t, StrValue("a much longer trace id")))
+	require.NoError(t, err)
+	assert.Equal(t, orig, buf, "input must not change")
+	want := encodeValue(t, mustMap(t,
+		StrValue("trace"), StrValue("a much longer trace id"),
+		StrValue("items"), ArrayValue(
+			mustMap(t, StrValue("id"), IntValue(1)),
+			mustMap(t, StrValue("id"), IntValue(2)),
+		),
+		IntValue(7), StrValue("seven"),
+	))
+	assert.Equal(t, want, out)
+
+	out, err = Replace(buf, encodePath(t, "items", 1, "id"), []byte{0xc0})
+	require.NoError(t, err)
+	doc := NewDocument(out)
+	isNil, err := doc.Get("items").Index(1).Get("id").IsNil()
+	require.NoError(t, err)
+	assert.True(t, isNil)
+	id, err := doc.Get("items").Index(0).Get("id").Int()
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, id)
+
+	// Integer map keys match by value whatever the path's encoding.
+	path := []byte{byte(FixArray) | 1, byte(Int64), 0, 0, 0, 0, 0, 0, 0, 7}
+	out, err = Replace(buf, path, []byte{0x07})
+	require.NoError(t, err)
+	n, err := NewDocument(out).GetInt(7).Int()
+	require.NoError(t, err)
+	assert.EqualValues(t, 7, n)
+
+	out, err = Replace(buf, encodePath(t), []byte{0xc3})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0xc3}, out)
+}
+
+func TestReplace_Errors(t *testing.T) {
+	buf := patchFixture(t)
+	for name, tc := range map[string]struct {
+		path, value []byte
+		err         error
+	}{
+		"missing key":     {encodePath(t, "nope"), []byte{0xc0}, ErrNotFound},
+		"index range":     {encodePath(t, "items", 2), []byte{0xc0}, ErrIndexRange},
+		"negative index":  {encodePath(t, "items", -1), []byte{0xc0}, ErrIndexRange},
+		"string on array": {encodePath(t, "items", "id"), []byte{0xc0}, ErrTypeMismatch},
+		"through scalar":  {encodePath(t, "trace", "x"), []byte{0xc0}, ErrTypeMismatch},
+		"path not array":  {[]byte{0xa1, 'a'}, []byte{0xc0}, ErrInvalidPath},
+		"bad step":        {[]byte{0x91, 0xc0}, []byte{0xc0}, ErrInvalidPath},
+		"trailing path":   {[]byte{0x90, 0xc0}, []byte{0xc0}, ErrInvalidPath},
+		"two values":      {encodePath(t, "trace"), []byte{0xc0, 0xc0}, ErrInvalidValue},
+		"truncated value": {encodePath(t, "trace"), []byte{0x91}, ErrInvalidValue},
+		"empty value":     {encodePath(t, "trace"), nil, ErrInvalidValue},
+	} {
+		_, err := Replace(buf, tc.path, tc.value)
+		assert.ErrorIs(t, err, tc.err, name)
+	}
+
+	_, err := Replace(buf[:len(buf)-2], encodePath(t, 7), []byte{0xc0})
+	assert.ErrorIs(t, err, ErrTruncated)
+}
+
+func TestDelete(t *testing.T) {
+	buf := patchFixture(t)
+	out, err := Delete(buf, encodePath(t, "items"))
+	require.NoError(t, err)
+	assert.Equal(t, encodeValue(t, mustMap(t,
+		StrValue("trace"), StrValue("abc"),
+		IntValue(7), StrValue("seven"),
+	)), out)
+
+	out, err = Delete(out, encodePath(t, 7))
+	require.NoError(t, err)
+	assert.Equal(t, encodeValue(t, mustMap(t, StrValue("trace"), StrValue("abc"))), out)
+
+	_, err = Delete(buf, encodePath(t, "nope"))
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = Delete(buf, encodePath(t, "items", 0))
+	assert.ErrorIs(t, err, ErrTypeMismatch)
+	_, err = Delete(buf, encodePath(t))
+	assert.ErrorIs(t, err, ErrInvalidPath)
+
+	// A wide header keeps its width.
+	wide := []byte{byte(Map16), 0, 1, 0xa1, 'a', 0x01}
+	out, err = Delete(wide, encodePath(t, "a"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte{byte(Map16), 0, 0}, out)
+}
+
+func TestInsert(t *testing.T) {
+	buf := patchFixture(t)
+	out, err := Insert(buf, encodePath(t, "items", 0, "name"), encodeValue(t, StrValue("first")))
+	require.NoError(t, err)
+	s, err := NewDocument(out).Get("items").Index(0).Get("name").Str()
+	require.NoError(t, err)
+	assert.Equal(t, "first", s)
+	id, err := NewDocument(out).Get("items").Index(1).Get("id").Int()
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, id)
+
+	_, err = Insert(buf, encodePath(t, "trace"), []byte{0xc0})
+	assert.ErrorIs(t, err, ErrDuplicateKey)
+	_, err = Insert(buf, encodePath(t, 7), []byte{0xc0})
+	assert.ErrorIs(t, err, ErrDuplicateKey)
+	_, err = Insert(buf, encodePath(t, "items", "x"), []byte{0xc0})
+	assert.ErrorIs(t, err, ErrTypeMismatch)
+	_, err = Insert(buf, encodePath(t, "x"), []byte{0xc0, 0xc0})
+	assert.ErrorIs(t, err, ErrInvalidValue)
+}
+
+func TestInsert_PromotesHeader(t *testing.T) {
+	// FixMap with 15 pairs becomes Map16.
+	var kv []Value
+	for i := 0; i < 15; i++ {
+		kv = append(kv, IntValue(int64(i)), NilValue())
+	}
+	buf := append(encodeValue(t, mustMap(t, kv...)), 0xc3) // trailing value survives
+	out, err := Insert(buf, encodePath(t, 15), []byte{0x01})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{byte(Map16), 0, 16}, out[:3])
+	r := &MsgpReader{Buff: out}
+	v, err := DecodeValue(r)
+	require.NoError(t, err)
+	assert.Equal(t, 16, v.Len())
+	e, ok := v.GetInt(15)
+	require.True(t, ok)
+	assert.EqualValues(t, 1, e.Int())
+	assert.Equal(t, []byte{0xc3}, out[r.Idx:])
+
+	// Map16 at 65535 pairs becomes Map32.
+	full := []byte{byte(Map16), 0xff, 0xff}
+	for i := 0; i < 0xffff; i++ {
+		full = append(full, byte(Nil), byte(Nil))
+	}
+	out, err = Insert(full, encodePath(t, "k"), []byte{0x01})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{byte(Map32), 0, 1, 0, 0}, out[:5])
+	assert.Equal(t, []byte{0xa1, 'k', 0x01}, out[len(out)-3:])
+}
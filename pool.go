@@ -0,0 +1,86 @@
+package msgpraw
+
+import "sync"
+
+// Writer buffers are pooled by capacity. Bucket i holds writers whose Buff
+// capacity is at least writerClasses[i] and below writerClasses[i+1]; a
+// writer that grew beyond maxPooledCap is left to the garbage collector, so
+// a one-off huge message doesn't stay pinned in the pool. So is one below
+// writerClasses[0], which AcquireWriter would have to grow anyway.
+var writerClasses = [...]int{1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10}
+
+const maxPooledCap = 1 << 20
+
+var (
+	writerPools [len(writerClasses)]sync.Pool
+	readerPool  = sync.Pool{New: func() any { return new(MsgpReader) }}
+)
+
+// AcquireWriter returns an empty writer from the pool, reusing the buffer of
+// a released writer when one is available. Return it with ReleaseWriter once
+// Buff is no longer referenced.
+func AcquireWriter() *MsgpWriter {
+	for i := range writerPools {
+		if w, _ := writerPools[i].Get().(*MsgpWriter); w != nil {
+			return w
+		}
+	}
+	return &MsgpWriter{Buff: make([]byte, 0, writerClasses[0])}
+}
+
+// AcquireWriterSize is AcquireWriter for a message expected to need about n
+// bytes: buckets too small for n are skipped.
+func AcquireWriterSize(n int) *MsgpWriter {
+	for i := writerClass(n); i < len(writerPools); i++ {
+		w, _ := writerPools[i].Get().(*MsgpWriter)
+		if w == nil {
+			continue
+		}
+		if cap(w.Buff) >= n {
+			return w
+		}
+		writerPools[i].Put(w)
+	}
+	size := writerClasses[0]
+	for size < n {
+		size *= 2
+	}
+	return &MsgpWriter{Buff: make([]byte, 0, size)}
+}
+
+// ReleaseWriter returns w to the pool. Options and open containers are
+// cleared; the caller must not use w or its Buff afterwards.
+func ReleaseWriter(w *MsgpWriter) {
+	c := cap(w.Buff)
+	if c < writerClasses[0] || c > maxPooledCap {
+		return
+	}
+	*w = MsgpWriter{Buff: w.Buff[:0], deferred: w.deferred[:0], cuts: w.cuts[:0]}
+	writerPools[writerClass(c)].Put(w)
+}
+
+// writerClass returns the bucket for a buffer of capacity c: the largest
+// class not above c, or bucket 0 for smaller buffers, which are not pooled
+// but give AcquireWriterSize its starting bucket.
+func writerClass(c int) int {
+	i := 0
+	for i+1 < len(writerClasses) && writerClasses[i+1] <= c {
+		i++
+	}
+	return i
+}
+
+// AcquireReader returns a pooled reader positioned at the start of buf.
+func AcquireReader(buf []byte) *MsgpReader {
+	r := readerPool.Get().(*MsgpReader)
+	r.Buff = buf
+	return r
+}
+
+// ReleaseReader returns r to the pool. The reference to its buffer is
+// dropped so the pool doesn't keep it alive.
+func ReleaseReader(r *MsgpReader) {
+	r.tracker.reset()
+	*r = MsgpReader{tracker: r.tracker}
+	readerPool.Put(r)
+}
@@ -0,0 +1,111 @@
+package msgpraw
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriterClass(t *testing.T) {
+	assert.Equal(t, 0, writerClass(0))
+	assert.Equal(t, 0, writerClass(4<<10-1))
+	assert.Equal(t, 1, writerClass(4<<10))
+	assert.Equal(t, len(writerClasses)-1, writerClass(maxPooledCap))
+}
+
+func TestAcquireWriter(t *testing.T) {
+	w := AcquireWriter()
+	require.NotNil(t, w)
+	assert.Equal(t, 0, w.Len())
+	assert.GreaterOrEqual(t, cap(w.Buff), writerClasses[0])
+
+	w.CompactHeaders = true
+	w.BeginArray()
+	require.NoError(t, w.WriteNil())
+	ReleaseWriter(w)
+	assert.Equal(t, 0, w.Len())
+	assert.False(t, w.CompactHeaders, "options are cleared on release")
+	assert.Empty(t, w.deferred)
+}
+
+func TestAcquireWriterSize(t *testing.T) {
+	w := AcquireWriterSize(100 << 10)
+	assert.GreaterOrEqual(t, cap(w.Buff), 100<<10)
+	ReleaseWriter(w)
+
+	w = AcquireWriterSize(10)
+	assert.GreaterOrEqual(t, cap(w.Buff), 10)
+	ReleaseWriter(w)
+}
+
+func TestReleaseWriter_DropsHuge(t *testing.T) {
+	for i := range writerPools {
+		for writerPools[i].Get() != nil {
+		}
+	}
+	ReleaseWriter(&MsgpWriter{Buff: make([]byte, 0, 10<<20)})
+	for i := range writerPools {
+		assert.Nil(t, writerPools[i].Get(), "bucket %d", i)
+	}
+}
+
+func TestReleaseWriter_DropsSmall(t *testing.T) {
+	for i := range writerPools {
+		for writerPools[i].Get() != nil {
+		}
+	}
+	ReleaseWriter(&MsgpWriter{})
+	ReleaseWriter(&MsgpWriter{Buff: make([]byte, 0, writerClasses[0]-1)})
+	for i := range writerPools {
+		assert.Nil(t, writerPools[i].Get(), "bucket %d", i)
+	}
+	assert.GreaterOrEqual(t, cap(AcquireWriter().Buff), writerClasses[0])
+}
+
+func TestAcquireReader(t *testing.T) {
+	buf := []byte{byte(Nil)}
+	r := AcquireReader(buf)
+	require.NoError(t, r.Skip())
+	ReleaseReader(r)
+	assert.Nil(t, r.Buff)
+	assert.Equal(t, 0, r.Idx)
+}
+
+func TestPool_NoAllocs(t *testing.T) {
+	ReleaseWriter(AcquireWriter())
+	allocs := testing.AllocsPerRun(100, func() {
+		w := AcquireWriter()
+		_ = w.WriteString("pooled")
+		r := AcquireReader(w.Buff)
+		_ = r.Skip()
+		ReleaseReader(r)
+		ReleaseWriter(w)
+	})
+	require.Zero(t, allocs)
+}
+
+func BenchmarkPool_Writer(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		w := AcquireWriter()
+		_ = w.WriteMap(1)
+		_ = w.WriteString("id")
+		_ = w.WriteInt(i)
+		ReleaseWriter(w)
+	}
+}
+
+func BenchmarkPool_WriterParallel(b *testing.B) {
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			w := AcquireWriter()
+			_ = w.WriteString("parallel")
+			r := AcquireReader(w.Buff)
+			_ = r.Skip()
+			ReleaseReader(r)
+			ReleaseWriter(w)
+		}
+	})
+}
@@ -0,0 +1,276 @@
+package msgpraw
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrSchemaViolation = errors.New("msgpraw: value does not match schema")
+	ErrInvalidSchema   = errors.New("msgpraw: invalid schema")
+)
+
+// SchemaType names the kind of value a Schema accepts.
+type SchemaType string
+
+const (
+	SchemaAny   SchemaType = "" // also spelled "any"
+	SchemaNil   SchemaType = "nil"
+	SchemaBool  SchemaType = "bool"
+	SchemaInt   SchemaType = "int"  // any integer format
+	SchemaUint  SchemaType = "uint" // any non-negative integer
+	SchemaFloat SchemaType = "float"
+	SchemaStr   SchemaType = "str"
+	SchemaBin   SchemaType = "bin"
+	SchemaExt   SchemaType = "ext"
+	SchemaArray SchemaType = "array"
+	SchemaMap   SchemaType = "map"
+)
+
+// Schema declares the expected shape of a value. It can be built in Go or
+// loaded from JSON with ParseSchema, which uses the same field names:
+//
+//	{
+//	  "type": "map",
+//	  "properties": {
+//	    "id":   {"type": "int"},
+//	    "tags": {"type": "array", "items": {"type": "str"}}
+//	  },
+//	  "required": ["id"]
+//	}
+type Schema struct {
+	Type SchemaType `json:"type,omitempty"`
+	// Nullable also accepts nil.
+	Nullable bool `json:"nullable,omitempty"`
+	// Items is the schema of every array element; nil accepts anything.
+	Items *Schema `json:"items,omitempty"`
+	// Properties are the schemas of a map's string keys.
+	Properties map[string]*Schema `json:"properties,omitempty"`
+	// Required lists the keys a map must contain.
+	Required []string `json:"required,omitempty"`
+	// Closed rejects map keys not listed in Properties.
+	Closed bool `json:"closed,omitempty"`
+}
+
+// Violation is one mismatch between a value and its schema. Path uses "$"
+// for the root, ".key" for map values and "[i]" for array elements.
+type Violation struct {
+	Path    string
+	Message string
+}
+
+func (v Violation) String() string { return v.Path + ": " + v.Message }
+
+// ValidationError lists every violation found by Validate. It matches
+// ErrSchemaViolation with errors.Is.
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		parts[i] = v.String()
+	}
+	return "msgpraw: schema violations: " + strings.Join(parts, "; ")
+}
+
+func (e *ValidationError) Is(target error) bool { return target == ErrSchemaViolation }
+
+// ParseSchema loads a schema from its JSON form.
+func ParseSchema(data []byte) (*Schema, error) {
+	var s Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+	}
+	if err := s.check("$"); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// check reports unknown type names anywhere in s.
+func (s *Schema) check(path string) error {
+	switch s.Type {
+	case SchemaAny, "any", SchemaNil, SchemaBool, SchemaInt, SchemaUint, SchemaFloat,
+		SchemaStr, SchemaBin, SchemaExt, SchemaArray, SchemaMap:
+	default:
+		return fmt.Errorf("%w: %s: unknown type %q", ErrInvalidSchema, path, s.Type)
+	}
+	if s.Items != nil {
+		if err := s.Items.check(path + "[]"); err != nil {
+			return err
+		}
+	}
+	for k, p := range s.Properties {
+		if p == nil {
+			continue
+		}
+		if err := p.check(path + "." + k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate checks that buf holds exactly one value matching s. It reads buf
+// once and reports every violation it finds as a *ValidationError. Malformed
+// input (ErrTruncated, ErrUnknownType, ...) and an invalid schema
+// (ErrInvalidSchema) are returned as such.
+func (s *Schema) Validate(buf []byte) error {
+	if err := s.check("$"); err != nil {
+		return err
+	}
+	v := validator{r: MsgpReader{Buff: buf}, path: []byte{'$'}}
+	if err := v.value(s, 0); err != nil {
+		return err
+	}
+	if v.r.Idx < len(buf) {
+		v.add("trailing data after the value")
+	}
+	if len(v.violations) > 0 {
+		return &ValidationError{Violations: v.violations}
+	}
+	return nil
+}
+
+type validator struct {
+	r          MsgpReader
+	path       []byte
+	violations []Violation
+}
+
+func (v *validator) add(format string, args ...any) {
+	v.violations = append(v.violations, Violation{Path: string(v.path), Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) value(s *Schema, depth int) error {
+	if depth > maxDepth {
+		return ErrMaxDepth
+	}
+	start := v.r.Idx
+	t, n, data, err := v.r.Read()
+	if err == EOF {
+		err = ErrTruncated
+	}
+	if err != nil {
+		return err
+	}
+	kind, ok := kindOf(t)
+	if !ok {
+		return ErrUnknownType
+	}
+
+	if s == nil || s.Type == SchemaAny || s.Type == "any" || (t == Nil && s.Nullable) {
+		return v.skipRest(start)
+	}
+	if !s.accepts(t, kind, data) {
+		v.add("expected %s, got %s", s.Type, kind)
+		return v.skipRest(start)
+	}
+
+	base := len(v.path)
+	defer func() { v.path = v.path[:base] }()
+	switch kind {
+	case KindArray:
+		for i := 0; i < n; i++ {
+			v.path = append(v.path[:base], '[')
+			v.path = strconv.AppendInt(v.path, int64(i), 10)
+			v.path = append(v.path, ']')
+			if err := v.value(s.Items, depth+1); err != nil {
+				return err
+			}
+		}
+	case KindMap:
+		var seen []bool
+		if len(s.Required) > 0 {
+			seen = make([]bool, len(s.Required))
+		}
+		for i := 0; i < n; i++ {
+			keyStart := v.r.Idx
+			kt, _, key, err := v.r.Read()
+			if err == nil && !kt.isStr() {
+				v.r.Idx = keyStart
+				err = v.r.SkipValue()
+			}
+			if err == EOF {
+				err = ErrTruncated
+			}
+			if err != nil {
+				return err
+			}
+			v.path = append(v.path[:base], '.')
+			if !kt.isStr() {
+				v.path = append(v.path, '*')
+				if s.Closed {
+					v.add("unexpected non-string key")
+				}
+				if err := v.value(nil, depth+1); err != nil {
+					return err
+				}
+				continue
+			}
+			v.path = append(v.path, key...)
+			for j, name := range s.Required {
+				if name == string(key) {
+					seen[j] = true
+				}
+			}
+			prop, known := s.Properties[string(key)]
+			if !known && s.Closed {
+				v.add("unexpected key")
+			}
+			if err := v.value(prop, depth+1); err != nil {
+				return err
+			}
+		}
+		v.path = v.path[:base]
+		for j, name := range s.Required {
+			if !seen[j] {
+				v.add("missing required key %q", name)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Schema) accepts(t Type, kind Kind, data []byte) bool {
+	switch s.Type {
+	case SchemaNil:
+		return kind == KindNil
+	case SchemaBool:
+		return kind == KindBool
+	case SchemaInt:
+		return kind == KindInt || kind == KindUint
+	case SchemaUint:
+		i, isUint, ok := intPayload(t, data)
+		return ok && (isUint || i >= 0)
+	case SchemaFloat:
+		return kind == KindFloat
+	case SchemaStr:
+		return kind == KindStr
+	case SchemaBin:
+		return kind == KindBin
+	case SchemaExt:
+		return kind == KindExt
+	case SchemaArray:
+		return kind == KindArray
+	case SchemaMap:
+		return kind == KindMap
+	}
+	return false
+}
+
+// skipRest skips the whole value starting at start, which has already been
+// read up to its children.
+func (v *validator) skipRest(start int) error {
+	v.r.Idx = start
+	err := v.r.SkipValue()
+	if err == EOF {
+		err = ErrTruncated
+	}
+	return err
+}
@@ -0,0 +1,125 @@
+package msgpraw
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var recordSchema = &Schema{
+	Type: SchemaMap,
+	Properties: map[string]*Schema{
+		"id":   {Type: SchemaInt},
+		"tags": {Type: SchemaArray, Items: &Schema{Type: SchemaStr}},
+		"meta": {Type: SchemaMap, Nullable: true, Closed: true, Properties: map[string]*Schema{
+			"score": {Type: SchemaFloat},
+		}},
+	},
+	Required: []string{"id"},
+}
+
+func TestSchema_Valid(t *testing.T) {
+	w := &MsgpWriter{}
+	require.NoError(t, w.WriteMap(4))
+	require.NoError(t, w.WriteString("id"))
+	require.NoError(t, w.WriteUint64(7))
+	require.NoError(t, w.WriteString("tags"))
+	require.NoError(t, w.WriteArray(1))
+	require.NoError(t, w.WriteString("x"))
+	require.NoError(t, w.WriteString("meta"))
+	require.NoError(t, w.WriteNil())
+	require.NoError(t, w.WriteString("extra")) // open map: allowed
+	require.NoError(t, w.WriteArray(1))
+	require.NoError(t, w.WriteBool(true))
+	require.NoError(t, recordSchema.Validate(w.Buff))
+}
+
+func TestSchema_CollectsAllViolations(t *testing.T) {
+	w := &MsgpWriter{}
+	require.NoError(t, w.WriteMap(2))
+	require.NoError(t, w.WriteString("tags"))
+	require.NoError(t, w.WriteArray(3))
+	require.NoError(t, w.WriteString("ok"))
+	require.NoError(t, w.WriteInt(1))
+	require.NoError(t, w.WriteMap(0))
+	require.NoError(t, w.WriteString("meta"))
+	require.NoError(t, w.WriteMap(2))
+	require.NoError(t, w.WriteString("score"))
+	require.NoError(t, w.WriteString("high"))
+	require.NoError(t, w.WriteString("other"))
+	require.NoError(t, w.WriteNil())
+
+	err := recordSchema.Validate(w.Buff)
+	require.ErrorIs(t, err, ErrSchemaViolation)
+	var verr *ValidationError
+	require.True(t, errors.As(err, &verr))
+	assert.Equal(t, []Violation{
+		{"$.tags[1]", "expected str, got int"},
+		{"$.tags[2]", "expected str, got map"},
+		{"$.meta.score", "expected float, got str"},
+		{"$.meta.other", "unexpected key"},
+		{"$", `missing required key "id"`},
+	}, verr.Violations)
+	assert.Contains(t, err.Error(), "$.tags[1]: expected str, got int")
+}
+
+func TestSchema_RootAndTrailing(t *testing.T) {
+	s := &Schema{Type: SchemaUint}
+	require.NoError(t, s.Validate([]byte{0x05}))
+
+	err := s.Validate([]byte{0xff}) // -1
+	var verr *ValidationError
+	require.True(t, errors.As(err, &verr))
+	assert.Equal(t, []Violation{{"$", "expected uint, got int"}}, verr.Violations)
+
+	err = s.Validate([]byte{0x05, 0x05})
+	require.True(t, errors.As(err, &verr))
+	assert.Equal(t, "trailing data after the value", verr.Violations[0].Message)
+}
+
+func TestSchema_MalformedInput(t *testing.T) {
+	require.ErrorIs(t, recordSchema.Validate([]byte{byte(FixMap) | 1, 0xa2, 'i', 'd'}), ErrTruncated)
+	require.ErrorIs(t, recordSchema.Validate(nil), ErrTruncated)
+	require.ErrorIs(t, (&Schema{}).Validate([]byte{0xc1}), ErrUnknownType)
+}
+
+func TestParseSchema(t *testing.T) {
+	s, err := ParseSchema([]byte(`{
+		"type": "map",
+		"properties": {
+			"id":   {"type": "int"},
+			"tags": {"type": "array", "items": {"type": "str"}}
+		},
+		"required": ["id", "tags"],
+		"closed": true
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, SchemaArray, s.Properties["tags"].Type)
+
+	w := &MsgpWriter{}
+	require.NoError(t, w.WriteMap(2))
+	require.NoError(t, w.WriteString("id"))
+	require.NoError(t, w.WriteString("not an int"))
+	require.NoError(t, w.WritePosFixInt(1)) // non-string key
+	require.NoError(t, w.WriteNil())
+	var verr *ValidationError
+	require.True(t, errors.As(s.Validate(w.Buff), &verr))
+	assert.Equal(t, []Violation{
+		{"$.id", "expected int, got str"},
+		{"$.*", "unexpected non-string key"},
+		{"$", `missing required key "tags"`},
+	}, verr.Violations)
+}
+
+func TestParseSchema_Invalid(t *testing.T) {
+	_, err := ParseSchema([]byte(`{"type": "map", "properties": {"a": {"type": "integer"}}}`))
+	require.ErrorIs(t, err, ErrInvalidSchema)
+	assert.Contains(t, err.Error(), "$.a")
+
+	_, err = ParseSchema([]byte(`{`))
+	require.ErrorIs(t, err, ErrInvalidSchema)
+
+	require.ErrorIs(t, (&Schema{Type: "nope"}).Validate([]byte{0xc0}), ErrInvalidSchema)
+}
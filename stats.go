@@ -0,0 +1,178 @@
+package msgpraw
+
+import "math"
+
+// PayloadStats summarises the values in a buffer. See Stats.
+type PayloadStats struct {
+	// Values is the number of values, containers and map keys included.
+	Values int
+	// ByType counts values per format. The fix formats are counted under
+	// PosFixInt, NegFixInt, FixStr, FixArray and FixMap; use Count to look up
+	// any tag.
+	ByType [256]int
+	// MaxDepth is the deepest nesting of any value: 0 for top-level values,
+	// 1 for their children and so on.
+	MaxDepth int
+	// MaxStr and MaxBin are the largest str and bin payloads in bytes.
+	MaxStr int
+	MaxBin int
+	// Keys counts the occurrences of every string map key.
+	Keys map[string]int
+	// Wasted is the number of bytes that the shortest encoding of the same
+	// values would have saved: over-long integers and length headers, and
+	// Float64 values that Float32 holds exactly.
+	Wasted int
+}
+
+// Count returns the number of values with tag t.
+func (s *PayloadStats) Count(t Type) int {
+	return s.ByType[typeFamily(t)]
+}
+
+// typeFamily maps the fix formats, which carry data in the tag, to their
+// first tag.
+func typeFamily(t Type) Type {
+	switch {
+	case t <= PosFixIntMax:
+		return PosFixInt
+	case t >= NegFixInt:
+		return NegFixInt
+	case t >= FixStr && t <= FixStrMax:
+		return FixStr
+	case t >= FixArray && t <= FixArrayMax:
+		return FixArray
+	case t >= FixMap && t <= FixMapMax:
+		return FixMap
+	}
+	return t
+}
+
+// Stats scans every value in buf and reports what it contains. Besides the
+// result it only allocates for counting keys, once per distinct key.
+func Stats(buf []byte) (*PayloadStats, error) {
+	s := statsScan{PayloadStats: &PayloadStats{}, keys: make(map[string]*int)}
+	r := &MsgpReader{Buff: buf}
+	for r.Idx < len(r.Buff) {
+		if err := s.value(r, 0, false); err != nil {
+			return nil, err
+		}
+	}
+	s.Keys = make(map[string]int, len(s.keys))
+	for k, n := range s.keys {
+		s.Keys[k] = *n
+	}
+	return s.PayloadStats, nil
+}
+
+// statsScan is the state of Stats. Keys are counted in keys first: looking
+// a key up with string(data) doesn't allocate, but assigning to it does.
+type statsScan struct {
+	*PayloadStats
+	keys map[string]*int
+}
+
+func (s *statsScan) value(r *MsgpReader, depth int, isKey bool) error {
+	if depth > maxDepth {
+		return ErrMaxDepth
+	}
+	start := r.Idx
+	t, n, data, err := r.Read()
+	if err == EOF && depth > 0 {
+		err = ErrTruncated
+	}
+	if err != nil {
+		return err
+	}
+	size := r.Idx - start
+	s.Values++
+	s.ByType[typeFamily(t)]++
+	if depth > s.MaxDepth {
+		s.MaxDepth = depth
+	}
+	if isKey && t.isStr() {
+		if n := s.keys[string(data)]; n != nil {
+			*n++
+		} else {
+			n = new(int)
+			*n = 1
+			s.keys[string(data)] = n
+		}
+	}
+
+	if v, isUint, ok := intPayload(t, data); ok {
+		s.Wasted += size - intSize(shortestIntType(v, isUint))
+		return nil
+	}
+	switch {
+	case t == Float64:
+		f, _ := floatPayload(t, data)
+		if float64(float32(f)) == f || math.IsNaN(f) {
+			s.Wasted += 4
+		}
+	case t.isStr():
+		if len(data) > s.MaxStr {
+			s.MaxStr = len(data)
+		}
+		s.Wasted += size - len(data) - minHeaderSize(t, len(data))
+	case t.isBin():
+		if len(data) > s.MaxBin {
+			s.MaxBin = len(data)
+		}
+		s.Wasted += size - len(data) - minHeaderSize(t, len(data))
+	case t.isExt():
+		s.Wasted += size - len(data) - minHeaderSize(t, len(data)-1)
+	case t.isArray(), t.isMap():
+		s.Wasted += size - minHeaderSize(t, n)
+		for i := 0; i < n; i++ {
+			if t.isMap() {
+				if err := s.value(r, depth+1, true); err != nil {
+					return err
+				}
+			}
+			if err := s.value(r, depth+1, false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// intSize returns the encoded size of an integer in format t.
+func intSize(t Type) int {
+	switch t {
+	case Uint8, Int8:
+		return 2
+	case Uint16, Int16:
+		return 3
+	case Uint32, Int32:
+		return 5
+	case Uint64, Int64:
+		return 9
+	}
+	return 1
+}
+
+// minHeaderSize returns the size of the shortest header for a str, bin or
+// ext value of length n or an array or map of n elements. For ext the
+// header excludes the ext type byte.
+func minHeaderSize(t Type, n int) int {
+	switch {
+	case t.isExt():
+		switch {
+		case n == 1, n == 2, n == 4, n == 8, n == 16:
+			return 1
+		case n <= maxUint8:
+			return 2
+		case n <= maxUint16:
+			return 3
+		}
+		return 5
+	case t.isStr() && n <= maxFixStr, (t.isArray() || t.isMap()) && n <= maxFixArray:
+		return 1
+	case (t.isStr() || t.isBin()) && n <= maxUint8:
+		return 2
+	case n <= maxUint16:
+		return 3
+	}
+	return 5
+}
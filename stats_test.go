@@ -0,0 +1,68 @@
+package msgpraw
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	w := &MsgpWriter{}
+	require.NoError(t, w.WriteMap16(2)) // 2 bytes wasted
+	require.NoError(t, w.WriteString("id"))
+	require.NoError(t, w.WriteInt64(5)) // 8 bytes wasted
+	require.NoError(t, w.WriteString("tags"))
+	require.NoError(t, w.WriteArray(2))
+	require.NoError(t, w.WriteStr8("abc"))                  // 1 byte wasted
+	require.NoError(t, w.WriteBin16([]byte{1, 2, 3, 4, 5})) // 1 byte wasted
+	require.NoError(t, w.WriteMap(1))
+	require.NoError(t, w.WriteString("id"))
+	require.NoError(t, w.WriteFloat64(0.5))          // 4 bytes wasted
+	require.NoError(t, w.WriteExt8(1, []byte{1, 2})) // 1 byte wasted
+
+	s, err := Stats(w.Buff)
+	require.NoError(t, err)
+	assert.Equal(t, 11, s.Values)
+	assert.Equal(t, 1, s.Count(Map16))
+	assert.Equal(t, 1, s.Count(FixMap|1))
+	assert.Equal(t, 3, s.Count(FixStr|2), "fix formats are counted per family")
+	assert.Equal(t, 1, s.Count(Int64))
+	assert.Equal(t, 1, s.ByType[FixArray])
+	assert.Equal(t, 2, s.MaxDepth)
+	assert.Equal(t, 4, s.MaxStr)
+	assert.Equal(t, 5, s.MaxBin)
+	assert.Equal(t, map[string]int{"id": 2, "tags": 1}, s.Keys)
+	assert.Equal(t, 2+8+1+1+4+1, s.Wasted)
+}
+
+func TestStats_Canonical(t *testing.T) {
+	canon, err := Canonicalize(allTagsFixture(t))
+	require.NoError(t, err)
+	s, err := Stats(canon)
+	require.NoError(t, err)
+	assert.Zero(t, s.Wasted, "canonical output wastes nothing")
+}
+
+func TestStats_Errors(t *testing.T) {
+	_, err := Stats([]byte{byte(FixArray) | 2, byte(Nil)})
+	require.ErrorIs(t, err, ErrTruncated)
+	_, err = Stats([]byte{0xc1})
+	require.ErrorIs(t, err, ErrUnknownType)
+}
+
+func TestStats_AllocsPerKey(t *testing.T) {
+	w := &MsgpWriter{}
+	require.NoError(t, w.WriteArray(100))
+	for i := 0; i < 100; i++ {
+		require.NoError(t, w.WriteMap(1))
+		// Long enough that converting it to a string allocates.
+		require.NoError(t, w.WriteString("request.headers.trace_id"))
+		require.NoError(t, w.WriteInt(i))
+	}
+	allocs := testing.AllocsPerRun(20, func() {
+		_, _ = Stats(w.Buff)
+	})
+	// The stats, the maps counting keys and the single key with its count.
+	assert.LessOrEqual(t, allocs, 8.0)
+}
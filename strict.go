@@ -0,0 +1,308 @@
+package msgpraw
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+var (
+	ErrNonCanonicalInt    = errors.New("msgpraw: integer not in its shortest encoding")
+	ErrNonCanonicalLength = errors.New("msgpraw: length or count not in its shortest encoding")
+	ErrNonCanonicalFloat  = errors.New("msgpraw: float not in its canonical encoding")
+	ErrNonCanonicalOrder  = errors.New("msgpraw: map keys not in ascending order")
+)
+
+// readChecked is Read with the checks enabled by Strict or ValidateUTF8. A
+// value that fails them is reported with Idx left at its start.
+func (r *MsgpReader) readChecked() (Type, int, []byte, error) {
+	plain := MsgpReader{Buff: r.Buff, Idx: r.Idx}
+	t, n, data, err := plain.Read()
+	if err == nil {
+		err = r.check(t, n, data)
+	}
+	if err == nil && r.Strict {
+		err = r.tracker.track(r.Buff, r.Idx, plain.Idx, t, n)
+	}
+	if err != nil {
+		return t, n, data, err
+	}
+	r.Idx = plain.Idx
+	return t, n, data, nil
+}
+
+// check applies the checks enabled on r to a value just returned by read.
+func (r *MsgpReader) check(t Type, n int, data []byte) error {
+	switch {
+	case r.Strict:
+		return checkStrict(t, n, data)
+	case t.isStr() && !ValidUTF8(data):
+		return ErrInvalidUTF8
+	}
+	return nil
+}
+
+// checkStrict validates a value just returned by read against the rules
+// enforced by MsgpReader.Strict, which match those of Canonicalize:
+//
+//   - integers must use the shortest format, with non-negative values in
+//     the positive fixint/uint formats (ErrNonCanonicalInt)
+//   - str, bin, ext, array and map lengths must use the shortest header,
+//     with the fixext formats preferred for ext (ErrNonCanonicalLength)
+//   - a float64 must not be exactly representable as float32, and the only
+//     NaN is the Float32 0x7fc00000 (ErrNonCanonicalFloat)
+//   - str payloads must be valid UTF-8 (ErrInvalidUTF8)
+//
+// Map keys are checked by keyTracker as they are read.
+func checkStrict(t Type, n int, data []byte) error {
+	if v, isUint, ok := intPayload(t, data); ok {
+		switch {
+		case t <= PosFixIntMax:
+			t = PosFixInt
+		case t >= NegFixInt:
+			t = NegFixInt
+		}
+		if t != shortestIntType(v, isUint) {
+			return ErrNonCanonicalInt
+		}
+		return nil
+	}
+	switch {
+	case t == Float32:
+		if b := binary.BigEndian.Uint32(data); b != canonicalNaN && math.IsNaN(float64(math.Float32frombits(b))) {
+			return ErrNonCanonicalFloat
+		}
+	case t == Float64:
+		if f, _ := floatPayload(t, data); math.IsNaN(f) || float64(float32(f)) == f {
+			return ErrNonCanonicalFloat
+		}
+	case t.isStr():
+		if !shortestLength(t, len(data)) {
+			return ErrNonCanonicalLength
+		}
+		if !ValidUTF8(data) {
+			return ErrInvalidUTF8
+		}
+	case t.isBin():
+		if !shortestLength(t, len(data)) {
+			return ErrNonCanonicalLength
+		}
+	case t.isExt():
+		if !shortestLength(t, len(data)-1) {
+			return ErrNonCanonicalLength
+		}
+	case t.isArray(), t.isMap():
+		if !shortestLength(t, n) {
+			return ErrNonCanonicalLength
+		}
+	}
+	return nil
+}
+
+// shortestIntType returns the format writeIntCompact and writeUintCompact
+// pick for v. PosFixInt and NegFixInt stand for their whole ranges.
+func shortestIntType(v int64, isUint bool) Type {
+	if isUint || v >= 0 {
+		u := uint64(v)
+		switch {
+		case u <= uint64(PosFixIntMax):
+			return PosFixInt
+		case u <= maxUint8:
+			return Uint8
+		case u <= maxUint16:
+			return Uint16
+		case u <= maxUint32:
+			return Uint32
+		}
+		return Uint64
+	}
+	switch {
+	case v >= -32:
+		return NegFixInt
+	case v >= -1<<7:
+		return Int8
+	case v >= -1<<15:
+		return Int16
+	case v >= -1<<31:
+		return Int32
+	}
+	return Int64
+}
+
+// shortestLength reports whether a header of type t is the shortest one for
+// a length (str, bin, ext data) or count (array, map) of n.
+func shortestLength(t Type, n int) bool {
+	switch t {
+	case Str8:
+		return n > maxFixStr
+	case Str16, Bin16, Ext16:
+		return n > maxUint8
+	case Array16:
+		return n > maxFixArray
+	case Map16:
+		return n > maxFixMap
+	case Str32, Bin32, Ext32, Array32, Map32:
+		return n > maxUint16
+	case Ext8:
+		return n != 1 && n != 2 && n != 4 && n != 8 && n != 16
+	}
+	return true
+}
+
+// keyTracker follows the containers a Strict reader is inside of, so that
+// each map's keys are checked to be in ascending order as they are read, in
+// a single pass over the input. Keys of a map are kept as offsets into the
+// buffer, so each is compared with the one before it.
+//
+// A reader moved back to the start of the value it just read, as done by
+// the iterators and FindKey, rewinds the tracker too. Any other jump drops
+// it, and only the maps opened from there on are checked.
+type keyTracker struct {
+	pos    int // Idx after the last tracked value
+	frames []trackedContainer
+	keys   [][2]int // keys of the open maps, each map's after its parent's
+}
+
+type trackedContainer struct {
+	start int // offset of the header
+	left  int // children not read yet; keys and values count separately
+	cur   int // offset of the last child read
+	isMap bool
+	isKey bool // the container is itself a map key
+	added bool // the last child is a key already added to keys
+	keys  int  // index of the map's first key in keyTracker.keys
+}
+
+// track records the value [start, end) with tag t and count n, just read
+// and checked otherwise. On an error the tracker is dropped.
+func (k *keyTracker) track(buf []byte, start, end int, t Type, n int) error {
+	if start != k.pos && !k.rewind(start) {
+		k.reset()
+	}
+	for len(k.frames) > 0 && k.frames[len(k.frames)-1].left == 0 {
+		k.pop()
+	}
+	err := k.add(buf, start, end, t, n)
+	if err != nil {
+		k.reset()
+		return err
+	}
+	k.pos = end
+	return nil
+}
+
+func (k *keyTracker) add(buf []byte, start, end int, t Type, n int) error {
+	isKey := false
+	if i := len(k.frames) - 1; i >= 0 {
+		f := &k.frames[i]
+		isKey = f.isMap && f.left%2 == 0
+		f.left--
+		f.cur, f.added = start, false
+	}
+	switch {
+	case n > 0 && (t.isArray() || t.isMap()):
+		if len(k.frames) >= maxDepth {
+			return ErrMaxDepth
+		}
+		f := trackedContainer{start: start, left: n, cur: -1, isMap: t.isMap(), isKey: isKey, keys: len(k.keys)}
+		if f.isMap {
+			f.left = 2 * n
+		}
+		k.frames = append(k.frames, f)
+		return nil
+	case isKey:
+		return k.addKey(buf, len(k.frames)-1, start, end)
+	}
+	// Containers completed by this value are done with their keys; one that
+	// is a map key is now whole and goes to its own map.
+	for i := len(k.frames) - 1; i >= 0 && k.frames[i].left == 0; i-- {
+		f := &k.frames[i]
+		k.keys = k.keys[:f.keys]
+		if f.isKey {
+			if err := k.addKey(buf, i-1, f.start, end); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addKey adds the key [start, end) to the map frames[i], whose keys must
+// be the last ones in k.keys. The key must sort after the map's previous
+// one: an equal key is ErrDuplicateKey, a smaller one ErrNonCanonicalOrder.
+func (k *keyTracker) addKey(buf []byte, i, start, end int) error {
+	f := &k.frames[i]
+	if len(k.keys) > f.keys {
+		prev := k.keys[len(k.keys)-1]
+		switch c := bytes.Compare(buf[prev[0]:prev[1]], buf[start:end]); {
+		case c == 0:
+			return ErrDuplicateKey
+		case c > 0:
+			return ErrNonCanonicalOrder
+		}
+	}
+	k.keys = append(k.keys, [2]int{start, end})
+	f.added = true
+	return nil
+}
+
+// removeLast undoes the last addKey on frames[i], if its last child was a
+// key.
+func (k *keyTracker) removeLast(i int) {
+	f := &k.frames[i]
+	if !f.added {
+		return
+	}
+	k.keys = k.keys[:len(k.keys)-1]
+	f.added = false
+}
+
+// rewind undoes the values read from off onwards. It reports false if off
+// is not the start of the last child of an open (or just completed)
+// container.
+func (k *keyTracker) rewind(off int) bool {
+	whole := true // every container removed so far was complete
+	for len(k.frames) > 0 && k.frames[len(k.frames)-1].start >= off {
+		f := k.frames[len(k.frames)-1]
+		whole = whole && f.left == 0
+		k.pop()
+		if f.isKey && whole && len(k.frames) > 0 {
+			k.removeLast(len(k.frames) - 1)
+		}
+	}
+	i := len(k.frames) - 1
+	if i < 0 {
+		k.pos = off
+		return true
+	}
+	if k.frames[i].cur != off {
+		return false
+	}
+	// Containers completed by the child at off are open again; those that
+	// are map keys leave their map until they complete anew.
+	for j := i; whole && j >= 0 && k.frames[j].left == 0; j-- {
+		if k.frames[j].isKey && j > 0 {
+			k.removeLast(j - 1)
+		}
+	}
+	k.removeLast(i)
+	k.frames[i].left++
+	k.pos = off
+	return true
+}
+
+func (k *keyTracker) pop() {
+	f := &k.frames[len(k.frames)-1]
+	if f.left > 0 {
+		// A complete container dropped its keys already, and its parent
+		// may have added more since.
+		k.keys = k.keys[:f.keys]
+	}
+	k.frames = k.frames[:len(k.frames)-1]
+}
+
+// reset drops all tracking state, keeping the slices for reuse.
+func (k *keyTracker) reset() {
+	*k = keyTracker{frames: k.frames[:0], keys: k.keys[:0]}
+}
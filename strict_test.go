@@ -0,0 +1,244 @@
+package msgpraw
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReader_StrictRejects(t *testing.T) {
+	long := string(make([]byte, 40))
+	cases := []struct {
+		name  string
+		write func(w *MsgpWriter) error
+		err   error
+	}{
+		{"int64_small", func(w *MsgpWriter) error { return w.WriteInt64(5) }, ErrNonCanonicalInt},
+		{"int8_positive", func(w *MsgpWriter) error { return w.WriteInt8(5) }, ErrNonCanonicalInt},
+		{"int16_fits_int8", func(w *MsgpWriter) error { return w.WriteInt16(-100) }, ErrNonCanonicalInt},
+		{"uint8_fixint", func(w *MsgpWriter) error { return w.WriteUint8(1) }, ErrNonCanonicalInt},
+		{"str8_short", func(w *MsgpWriter) error { return w.WriteStr8("a") }, ErrNonCanonicalLength},
+		{"str16_short", func(w *MsgpWriter) error { return w.WriteStr16(long) }, ErrNonCanonicalLength},
+		{"bin16_short", func(w *MsgpWriter) error { return w.WriteBin16([]byte{1}) }, ErrNonCanonicalLength},
+		{"ext8_fixed", func(w *MsgpWriter) error { return w.WriteExt8(1, []byte{1, 2, 3, 4}) }, ErrNonCanonicalLength},
+		{"array16_small", func(w *MsgpWriter) error { return w.WriteArray16(0) }, ErrNonCanonicalLength},
+		{"array32_small", func(w *MsgpWriter) error { return w.WriteArray32(1000) }, ErrNonCanonicalLength},
+		{"map16_small", func(w *MsgpWriter) error { return w.WriteMap16(0) }, ErrNonCanonicalLength},
+		{"invalid_utf8", func(w *MsgpWriter) error { return w.WriteString("a\xffb") }, ErrInvalidUTF8},
+		{"float64_fits_float32", func(w *MsgpWriter) error { return w.WriteFloat64(1.5) }, ErrNonCanonicalFloat},
+		{"float64_nan", func(w *MsgpWriter) error { return w.WriteFloat64(math.NaN()) }, ErrNonCanonicalFloat},
+		{"float32_other_nan", func(w *MsgpWriter) error { return w.WriteFloat32(math.Float32frombits(0x7fc00001)) }, ErrNonCanonicalFloat},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := &MsgpWriter{}
+			require.NoError(t, tc.write(w))
+
+			r := &MsgpReader{Buff: w.Buff, Strict: true}
+			_, _, _, err := r.Read()
+			require.ErrorIs(t, err, tc.err)
+			assert.Equal(t, 0, r.Idx, "Idx must stay at the rejected value")
+
+			// The same bytes are fine for a lenient reader.
+			_, _, _, err = (&MsgpReader{Buff: w.Buff}).Read()
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestReader_StrictAcceptsCanonical(t *testing.T) {
+	canon, err := Canonicalize(allTagsFixture(t))
+	require.NoError(t, err)
+
+	r := &MsgpReader{Buff: canon, Strict: true}
+	for {
+		err := r.SkipValue()
+		if err == EOF {
+			break
+		}
+		require.NoError(t, err)
+	}
+}
+
+func TestReader_StrictDuplicateKey(t *testing.T) {
+	for _, n := range []int{2, 40} {
+		w := &MsgpWriter{}
+		require.NoError(t, w.WriteMap(n))
+		for i := 0; i < n-1; i++ {
+			require.NoError(t, w.WritePosFixInt(uint8(i)))
+			require.NoError(t, w.WriteNil())
+		}
+		require.NoError(t, w.WritePosFixInt(uint8(n-2)))
+		require.NoError(t, w.WriteNil())
+
+		r := &MsgpReader{Buff: w.Buff, Strict: true}
+		require.ErrorIs(t, r.SkipValue(), ErrDuplicateKey, "n=%d", n)
+		assert.Equal(t, len(w.Buff)-2, r.Idx, "Idx must stay at the duplicate key")
+	}
+}
+
+func TestReader_StrictDuplicateKeyScope(t *testing.T) {
+	// The same key in sibling maps is fine.
+	w := &MsgpWriter{}
+	require.NoError(t, w.WriteMap(2))
+	for _, k := range []string{"a", "b"} {
+		require.NoError(t, w.WriteString(k))
+		require.NoError(t, w.WriteMap(1))
+		require.NoError(t, w.WriteString("a"))
+		require.NoError(t, w.WriteNil())
+	}
+	require.NoError(t, (&MsgpReader{Buff: w.Buff, Strict: true}).SkipValue())
+
+	// A key repeated after a nested map still belongs to the outer one.
+	w = &MsgpWriter{}
+	require.NoError(t, w.WriteMap(2))
+	require.NoError(t, w.WriteString("a"))
+	require.NoError(t, w.WriteMap(1))
+	require.NoError(t, w.WriteString("b"))
+	require.NoError(t, w.WriteNil())
+	require.NoError(t, w.WriteString("a"))
+	require.NoError(t, w.WriteNil())
+	require.ErrorIs(t, (&MsgpReader{Buff: w.Buff, Strict: true}).SkipValue(), ErrDuplicateKey)
+
+	// Container keys are compared whole.
+	w = &MsgpWriter{}
+	require.NoError(t, w.WriteMap(3))
+	for _, k := range []uint8{1, 2, 2} {
+		require.NoError(t, w.WriteArray(2))
+		require.NoError(t, w.WritePosFixInt(k))
+		require.NoError(t, w.WriteNil())
+		require.NoError(t, w.WriteNil())
+	}
+	require.ErrorIs(t, (&MsgpReader{Buff: w.Buff, Strict: true}).SkipValue(), ErrDuplicateKey)
+}
+
+func TestReader_StrictKeyOrder(t *testing.T) {
+	// Keys sort by their encoded bytes, so 1 (0x01) comes before "a" (0xa1 0x61)
+	// and "b" before "aa" (0xa2 ...).
+	w := &MsgpWriter{}
+	require.NoError(t, w.WriteMap(3))
+	require.NoError(t, w.WritePosFixInt(1))
+	require.NoError(t, w.WriteNil())
+	require.NoError(t, w.WriteString("b"))
+	require.NoError(t, w.WriteNil())
+	require.NoError(t, w.WriteString("aa"))
+	require.NoError(t, w.WriteNil())
+	require.NoError(t, (&MsgpReader{Buff: w.Buff, Strict: true}).SkipValue())
+
+	w = &MsgpWriter{}
+	require.NoError(t, w.WriteMap(2))
+	require.NoError(t, w.WriteString("b"))
+	require.NoError(t, w.WriteNil())
+	require.NoError(t, w.WriteString("a"))
+	require.NoError(t, w.WriteNil())
+	r := &MsgpReader{Buff: w.Buff, Strict: true}
+	require.ErrorIs(t, r.SkipValue(), ErrNonCanonicalOrder)
+	assert.Equal(t, len(w.Buff)-3, r.Idx, "Idx must stay at the out-of-order key")
+
+	// A container key is compared once it is whole.
+	w = &MsgpWriter{}
+	require.NoError(t, w.WriteMap(2))
+	for _, k := range []uint8{2, 1} {
+		require.NoError(t, w.WriteArray(1))
+		require.NoError(t, w.WritePosFixInt(k))
+		require.NoError(t, w.WriteNil())
+	}
+	r = &MsgpReader{Buff: w.Buff, Strict: true}
+	require.ErrorIs(t, r.SkipValue(), ErrNonCanonicalOrder)
+	assert.Equal(t, len(w.Buff)-2, r.Idx, "Idx must stay at the value that completes the key")
+}
+
+func TestReader_StrictDuplicateKeyIter(t *testing.T) {
+	w := &MsgpWriter{}
+	require.NoError(t, w.WriteArray(1))
+	require.NoError(t, w.WriteMap(3))
+	for _, k := range []string{"a", "b", "b"} {
+		require.NoError(t, w.WriteString(k))
+		require.NoError(t, w.WriteArray(1))
+		require.NoError(t, w.WriteNil())
+	}
+
+	// Reading each value whole makes the iterator move back to it.
+	r := &MsgpReader{Buff: w.Buff, Strict: true}
+	require.NoError(t, r.Skip())
+	it, err := r.MapIter()
+	require.NoError(t, err)
+	for it.Next() {
+		require.NoError(t, r.SkipValue())
+	}
+	require.ErrorIs(t, it.Err(), ErrDuplicateKey)
+}
+
+func TestReader_StrictLinear(t *testing.T) {
+	// {"a": nil, "b": {"a": nil, "b": ... {}}} nested depth times.
+	nested := func(depth int) []byte {
+		w := &MsgpWriter{}
+		for i := 0; i < depth; i++ {
+			require.NoError(t, w.WriteMap(2))
+			require.NoError(t, w.WriteString("a"))
+			require.NoError(t, w.WriteNil())
+			require.NoError(t, w.WriteString("b"))
+		}
+		require.NoError(t, w.WriteMap(0))
+		return w.Buff
+	}
+	elapsed := func(buf []byte) time.Duration {
+		best := time.Duration(1<<63 - 1)
+		for i := 0; i < 5; i++ {
+			start := time.Now()
+			require.NoError(t, (&MsgpReader{Buff: buf, Strict: true}).SkipValue())
+			if d := time.Since(start); d < best {
+				best = d
+			}
+		}
+		return best
+	}
+	small, large := elapsed(nested(500)), elapsed(nested(8000))
+	// Quadratic work would take 256 times as long for 16 times the input.
+	assert.Less(t, large, 40*small+time.Millisecond, "small %v, large %v", small, large)
+}
+
+func TestReader_StrictNested(t *testing.T) {
+	w := &MsgpWriter{}
+	require.NoError(t, w.WriteArray(2))
+	require.NoError(t, w.WriteNil())
+	require.NoError(t, w.WriteInt32(1))
+
+	r := &MsgpReader{Buff: w.Buff, Strict: true}
+	require.ErrorIs(t, r.SkipValue(), ErrNonCanonicalInt)
+	_, err := DecodeValue(&MsgpReader{Buff: w.Buff, Strict: true})
+	require.ErrorIs(t, err, ErrNonCanonicalInt)
+}
+
+func TestReader_StrictNoAllocs(t *testing.T) {
+	canon, err := Canonicalize(allTagsFixture(t))
+	require.NoError(t, err)
+	allocs := testing.AllocsPerRun(100, func() {
+		r := MsgpReader{Buff: canon, Strict: true}
+		for r.SkipValue() == nil {
+		}
+	})
+	require.Zero(t, allocs)
+
+	// Tracking map keys reuses the reader's state once it has grown.
+	w := &MsgpWriter{}
+	for i := 0; i < 8; i++ {
+		require.NoError(t, w.WriteMap(2))
+		require.NoError(t, w.WriteString("k"))
+		require.NoError(t, w.WriteArray(1))
+	}
+	require.NoError(t, w.WriteNil())
+	for i := 0; i < 8; i++ {
+		require.NoError(t, w.WriteString("v"))
+		require.NoError(t, w.WriteNil())
+	}
+	r := MsgpReader{Buff: w.Buff, Strict: true}
+	allocs = testing.AllocsPerRun(100, func() {
+		r.Idx = 0
+		require.NoError(t, r.SkipValue())
+	})
+	require.Zero(t, allocs)
+}
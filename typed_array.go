@@ -0,0 +1,255 @@
+package msgpraw
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+var (
+	ErrTypedArrayElem = errors.New("msgpraw: unsupported typed array element type")
+	ErrTypedArraySize = errors.New("msgpraw: typed array payload is not a whole number of elements")
+)
+
+// TypedArrayExt is the ext type of the typed-array format: a dense array of
+// fixed-width numbers packed into a single ext value. The payload is one
+// ElemType byte followed by the elements, each big-endian, with no padding:
+//
+//	Ext32 | length (uint32) | TypedArrayExt | ElemType | elem 0 | elem 1 | ...
+//
+// length counts the ElemType byte plus the packed elements. Floats are
+// IEEE 754 bit patterns. WriteTypedArray always emits Ext32; readers accept
+// the format in any ext header.
+const TypedArrayExt int8 = 0x54
+
+// ElemType identifies the element type of a typed array.
+type ElemType byte
+
+const (
+	ElemInt8    ElemType = 0x01
+	ElemInt16   ElemType = 0x02
+	ElemInt32   ElemType = 0x03
+	ElemInt64   ElemType = 0x04
+	ElemUint8   ElemType = 0x05
+	ElemUint16  ElemType = 0x06
+	ElemUint32  ElemType = 0x07
+	ElemUint64  ElemType = 0x08
+	ElemFloat32 ElemType = 0x09
+	ElemFloat64 ElemType = 0x0a
+)
+
+// Size returns the encoded size of one element, or 0 for an unknown type.
+func (e ElemType) Size() int {
+	switch e {
+	case ElemInt8, ElemUint8:
+		return 1
+	case ElemInt16, ElemUint16:
+		return 2
+	case ElemInt32, ElemUint32, ElemFloat32:
+		return 4
+	case ElemInt64, ElemUint64, ElemFloat64:
+		return 8
+	}
+	return 0
+}
+
+// WriteTypedArray writes s, which must be a []int8, []int16, []int32,
+// []int64, []uint8, []uint16, []uint32, []uint64, []float32 or []float64,
+// as a typed-array ext value. Any other type is ErrTypedArrayElem.
+func (w *MsgpWriter) WriteTypedArray(s any) error {
+	switch s := s.(type) {
+	case []int8:
+		if err := w.beginTypedArray(ElemInt8, len(s)); err != nil {
+			return err
+		}
+		for _, v := range s {
+			w.Buff = append(w.Buff, byte(v))
+		}
+	case []int16:
+		if err := w.beginTypedArray(ElemInt16, len(s)); err != nil {
+			return err
+		}
+		for _, v := range s {
+			w.Buff = binary.BigEndian.AppendUint16(w.Buff, uint16(v))
+		}
+	case []int32:
+		if err := w.beginTypedArray(ElemInt32, len(s)); err != nil {
+			return err
+		}
+		for _, v := range s {
+			w.Buff = binary.BigEndian.AppendUint32(w.Buff, uint32(v))
+		}
+	case []int64:
+		if err := w.beginTypedArray(ElemInt64, len(s)); err != nil {
+			return err
+		}
+		for _, v := range s {
+			w.Buff = binary.BigEndian.AppendUint64(w.Buff, uint64(v))
+		}
+	case []uint8:
+		if err := w.beginTypedArray(ElemUint8, len(s)); err != nil {
+			return err
+		}
+		w.Buff = append(w.Buff, s...)
+	case []uint16:
+		if err := w.beginTypedArray(ElemUint16, len(s)); err != nil {
+			return err
+		}
+		for _, v := range s {
+			w.Buff = binary.BigEndian.AppendUint16(w.Buff, v)
+		}
+	case []uint32:
+		if err := w.beginTypedArray(ElemUint32, len(s)); err != nil {
+			return err
+		}
+		for _, v := range s {
+			w.Buff = binary.BigEndian.AppendUint32(w.Buff, v)
+		}
+	case []uint64:
+		if err := w.beginTypedArray(ElemUint64, len(s)); err != nil {
+			return err
+		}
+		for _, v := range s {
+			w.Buff = binary.BigEndian.AppendUint64(w.Buff, v)
+		}
+	case []float32:
+		if err := w.beginTypedArray(ElemFloat32, len(s)); err != nil {
+			return err
+		}
+		for _, v := range s {
+			w.Buff = binary.BigEndian.AppendUint32(w.Buff, math.Float32bits(v))
+		}
+	case []float64:
+		if err := w.beginTypedArray(ElemFloat64, len(s)); err != nil {
+			return err
+		}
+		for _, v := range s {
+			w.Buff = binary.BigEndian.AppendUint64(w.Buff, math.Float64bits(v))
+		}
+	default:
+		return ErrTypedArrayElem
+	}
+	return nil
+}
+
+// beginTypedArray grows Buff for n elements of type e and writes everything
+// up to and including the ElemType byte.
+func (w *MsgpWriter) beginTypedArray(e ElemType, n int) error {
+	size := 1 + uint64(n)*uint64(e.Size())
+	if size > maxUint32 {
+		return ErrExtTooLong
+	}
+	if need := 6 + int(size); cap(w.Buff)-len(w.Buff) < need {
+		w.Buff = append(w.Buff, make([]byte, need)...)[:len(w.Buff)]
+	}
+	w.Buff = append(w.Buff, byte(Ext32))
+	w.Buff = binary.BigEndian.AppendUint32(w.Buff, uint32(size))
+	w.Buff = append(w.Buff, byte(TypedArrayExt), byte(e))
+	return nil
+}
+
+// ReadTypedArrayRaw reads a typed-array ext value and returns its element
+// type and packed big-endian elements as a sub-slice of Buff. A value that
+// is not a TypedArrayExt ext is ErrTypeMismatch; on any error Idx is left at
+// the value.
+func (r *MsgpReader) ReadTypedArrayRaw() (ElemType, []byte, error) {
+	start := r.Idx
+	t, _, data, err := r.Read()
+	if err == nil && (!t.isExt() || int8(data[0]) != TypedArrayExt) {
+		err = ErrTypeMismatch
+	}
+	if err == nil && len(data) < 2 {
+		err = ErrTypedArraySize
+	}
+	if err != nil {
+		r.Idx = start
+		return 0, nil, err
+	}
+	e, packed := ElemType(data[1]), data[2:]
+	switch {
+	case e.Size() == 0:
+		err = ErrTypedArrayElem
+	case len(packed)%e.Size() != 0:
+		err = ErrTypedArraySize
+	}
+	if err != nil {
+		r.Idx = start
+		return 0, nil, err
+	}
+	return e, packed, nil
+}
+
+// ReadTypedArray reads a typed-array ext value into dst, a pointer to a
+// slice whose element type matches the array's (*[]float64 for
+// ElemFloat64, ...). The slice is overwritten, reusing its capacity. A
+// mismatched dst is ErrTypeMismatch, an unsupported one ErrTypedArrayElem.
+func (r *MsgpReader) ReadTypedArray(dst any) error {
+	start := r.Idx
+	e, p, err := r.ReadTypedArrayRaw()
+	if err != nil {
+		return err
+	}
+	ok := true
+	switch dst := dst.(type) {
+	case *[]int8:
+		if ok = e == ElemInt8; ok {
+			*dst = unpack(*dst, p, 1, func(b []byte) int8 { return int8(b[0]) })
+		}
+	case *[]int16:
+		if ok = e == ElemInt16; ok {
+			*dst = unpack(*dst, p, 2, func(b []byte) int16 { return int16(binary.BigEndian.Uint16(b)) })
+		}
+	case *[]int32:
+		if ok = e == ElemInt32; ok {
+			*dst = unpack(*dst, p, 4, func(b []byte) int32 { return int32(binary.BigEndian.Uint32(b)) })
+		}
+	case *[]int64:
+		if ok = e == ElemInt64; ok {
+			*dst = unpack(*dst, p, 8, func(b []byte) int64 { return int64(binary.BigEndian.Uint64(b)) })
+		}
+	case *[]uint8:
+		if ok = e == ElemUint8; ok {
+			*dst = append((*dst)[:0], p...)
+		}
+	case *[]uint16:
+		if ok = e == ElemUint16; ok {
+			*dst = unpack(*dst, p, 2, binary.BigEndian.Uint16)
+		}
+	case *[]uint32:
+		if ok = e == ElemUint32; ok {
+			*dst = unpack(*dst, p, 4, binary.BigEndian.Uint32)
+		}
+	case *[]uint64:
+		if ok = e == ElemUint64; ok {
+			*dst = unpack(*dst, p, 8, binary.BigEndian.Uint64)
+		}
+	case *[]float32:
+		if ok = e == ElemFloat32; ok {
+			*dst = unpack(*dst, p, 4, func(b []byte) float32 { return math.Float32frombits(binary.BigEndian.Uint32(b)) })
+		}
+	case *[]float64:
+		if ok = e == ElemFloat64; ok {
+			*dst = unpack(*dst, p, 8, func(b []byte) float64 { return math.Float64frombits(binary.BigEndian.Uint64(b)) })
+		}
+	default:
+		r.Idx = start
+		return ErrTypedArrayElem
+	}
+	if !ok {
+		r.Idx = start
+		return ErrTypeMismatch
+	}
+	return nil
+}
+
+func unpack[T any](dst []T, packed []byte, size int, get func([]byte) T) []T {
+	n := len(packed) / size
+	if cap(dst) < n {
+		dst = make([]T, n)
+	}
+	dst = dst[:n]
+	for i := range dst {
+		dst[i] = get(packed[i*size:])
+	}
+	return dst
+}
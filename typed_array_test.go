@@ -0,0 +1,176 @@
+package msgpraw
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTypedArray_RoundTrip(t *testing.T) {
+	cases := []struct {
+		in  any
+		out any // pointer to an empty slice of the same type
+	}{
+		{[]int8{math.MinInt8, 0, math.MaxInt8}, new([]int8)},
+		{[]int16{math.MinInt16, -1}, new([]int16)},
+		{[]int32{math.MinInt32, 1}, new([]int32)},
+		{[]int64{math.MinInt64, math.MaxInt64}, new([]int64)},
+		{[]uint8{0, 255}, new([]uint8)},
+		{[]uint16{math.MaxUint16}, new([]uint16)},
+		{[]uint32{math.MaxUint32, 0}, new([]uint32)},
+		{[]uint64{math.MaxUint64}, new([]uint64)},
+		{[]float32{1.5, float32(math.Inf(-1))}, new([]float32)},
+		{[]float64{-0.25, math.MaxFloat64}, new([]float64)},
+	}
+	for _, tc := range cases {
+		w := &MsgpWriter{}
+		require.NoError(t, w.WriteTypedArray(tc.in))
+		r := &MsgpReader{Buff: w.Buff}
+		require.NoError(t, r.ReadTypedArray(tc.out))
+		assert.Equal(t, len(w.Buff), r.Idx)
+		assert.EqualValues(t, tc.in, derefSlice(tc.out), "%T", tc.in)
+	}
+
+	w := &MsgpWriter{}
+	require.NoError(t, w.WriteTypedArray([]float64{}))
+	got := []float64{1}
+	require.NoError(t, (&MsgpReader{Buff: w.Buff}).ReadTypedArray(&got))
+	assert.Empty(t, got)
+}
+
+func derefSlice(p any) any {
+	switch p := p.(type) {
+	case *[]int8:
+		return *p
+	case *[]int16:
+		return *p
+	case *[]int32:
+		return *p
+	case *[]int64:
+		return *p
+	case *[]uint8:
+		return *p
+	case *[]uint16:
+		return *p
+	case *[]uint32:
+		return *p
+	case *[]uint64:
+		return *p
+	case *[]float32:
+		return *p
+	case *[]float64:
+		return *p
+	}
+	return nil
+}
+
+func TestTypedArray_WireFormat(t *testing.T) {
+	w := &MsgpWriter{}
+	require.NoError(t, w.WriteTypedArray([]uint16{1, 0x0203}))
+	assert.Equal(t, []byte{
+		byte(Ext32), 0, 0, 0, 5, byte(TypedArrayExt), byte(ElemUint16),
+		0x00, 0x01, 0x02, 0x03,
+	}, w.Buff)
+
+	// Any ext header is accepted on read.
+	w = &MsgpWriter{}
+	require.NoError(t, w.WriteExt(TypedArrayExt, []byte{byte(ElemInt16), 0xff, 0xfe}))
+	var got []int16
+	require.NoError(t, (&MsgpReader{Buff: w.Buff}).ReadTypedArray(&got))
+	assert.Equal(t, []int16{-2}, got)
+}
+
+func TestTypedArray_Raw(t *testing.T) {
+	w := &MsgpWriter{}
+	require.NoError(t, w.WriteTypedArray([]float32{1, 2}))
+	e, packed, err := (&MsgpReader{Buff: w.Buff}).ReadTypedArrayRaw()
+	require.NoError(t, err)
+	assert.Equal(t, ElemFloat32, e)
+	assert.Equal(t, 8, len(packed))
+	assert.Equal(t, &w.Buff[7], &packed[0], "payload is not copied")
+}
+
+func TestTypedArray_ReusesDst(t *testing.T) {
+	w := &MsgpWriter{}
+	require.NoError(t, w.WriteTypedArray([]float64{1, 2}))
+	dst := make([]float64, 5, 8)
+	p := &dst[0]
+	require.NoError(t, (&MsgpReader{Buff: w.Buff}).ReadTypedArray(&dst))
+	assert.Equal(t, []float64{1, 2}, dst)
+	assert.Equal(t, p, &dst[0])
+}
+
+func TestTypedArray_Growth(t *testing.T) {
+	w := &MsgpWriter{}
+	grows := 0
+	for i := 0; i < 10000; i++ {
+		c := cap(w.Buff)
+		require.NoError(t, w.WriteTypedArray([]float64{1, 2, 3, 4}))
+		if cap(w.Buff) != c {
+			grows++
+		}
+	}
+	assert.Less(t, grows, 40)
+}
+
+func TestTypedArray_Errors(t *testing.T) {
+	w := &MsgpWriter{}
+	require.ErrorIs(t, w.WriteTypedArray([]int{1}), ErrTypedArrayElem)
+	require.ErrorIs(t, w.WriteTypedArray("x"), ErrTypedArrayElem)
+	assert.Empty(t, w.Buff)
+
+	ext := func(typ int8, data ...byte) []byte {
+		w := &MsgpWriter{}
+		require.NoError(t, w.WriteExt(typ, data))
+		return w.Buff
+	}
+	cases := []struct {
+		name string
+		buf  []byte
+		dst  any
+		err  error
+	}{
+		{"not_ext", []byte{byte(Nil)}, new([]int8), ErrTypeMismatch},
+		{"other_ext", ext(1, byte(ElemInt8), 1), new([]int8), ErrTypeMismatch},
+		{"no_elem_type", ext(TypedArrayExt), new([]int8), ErrTypedArraySize},
+		{"unknown_elem", ext(TypedArrayExt, 0x7f, 0), new([]int8), ErrTypedArrayElem},
+		{"ragged", ext(TypedArrayExt, byte(ElemInt32), 1, 2, 3, 4, 5, 6, 7), new([]int32), ErrTypedArraySize},
+		{"wrong_dst", ext(TypedArrayExt, byte(ElemInt8), 1), new([]uint8), ErrTypeMismatch},
+		{"unsupported_dst", ext(TypedArrayExt, byte(ElemInt8), 1), new([]int), ErrTypedArrayElem},
+		{"truncated", []byte{byte(Ext32), 0, 0, 0, 9, byte(TypedArrayExt)}, new([]int8), ErrTruncated},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &MsgpReader{Buff: tc.buf}
+			require.ErrorIs(t, r.ReadTypedArray(tc.dst), tc.err)
+			assert.Equal(t, 0, r.Idx)
+		})
+	}
+}
+
+func TestTypedArray_NoAllocs(t *testing.T) {
+	src := make([]float64, 128)
+	w := &MsgpWriter{Buff: make([]byte, 0, 2048)}
+	dst := make([]float64, 0, len(src))
+	allocs := testing.AllocsPerRun(100, func() {
+		w.Reset()
+		_ = w.WriteTypedArray(src)
+		r := MsgpReader{Buff: w.Buff}
+		_ = r.ReadTypedArray(&dst)
+	})
+	require.Zero(t, allocs)
+}
+
+func BenchmarkWriteTypedArray_Float64(b *testing.B) {
+	src := make([]float64, 1<<16)
+	w := &MsgpWriter{Buff: make([]byte, 0, 7+8*len(src))}
+	b.SetBytes(int64(8 * len(src)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w.Reset()
+		_ = w.WriteTypedArray(src)
+	}
+}
@@ -45,3 +45,23 @@ const (
 	NegFixInt    Type = 0xe0
 	NegFixIntMax Type = 0xff
 )
+
+func (t Type) isArray() bool {
+	return (t >= FixArray && t <= FixArrayMax) || t == Array16 || t == Array32
+}
+
+func (t Type) isMap() bool {
+	return (t >= FixMap && t <= FixMapMax) || t == Map16 || t == Map32
+}
+
+func (t Type) isStr() bool {
+	return (t >= FixStr && t <= FixStrMax) || t == Str8 || t == Str16 || t == Str32
+}
+
+func (t Type) isBin() bool {
+	return t == Bin8 || t == Bin16 || t == Bin32
+}
+
+func (t Type) isExt() bool {
+	return (t >= FixExt1 && t <= FixExt16) || t == Ext8 || t == Ext16 || t == Ext32
+}
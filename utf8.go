@@ -0,0 +1,11 @@
+package msgpraw
+
+import (
+	"errors"
+	"unicode/utf8"
+)
+
+var ErrInvalidUTF8 = errors.New("msgpraw: string is not valid UTF-8")
+
+// ValidUTF8 reports whether b is valid UTF-8.
+func ValidUTF8(b []byte) bool { return utf8.Valid(b) }
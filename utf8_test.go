@@ -0,0 +1,83 @@
+package msgpraw
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidUTF8(t *testing.T) {
+	cases := []string{
+		"",
+		"hello",
+		strings.Repeat("ascii only ", 10),
+		"héllo",
+		strings.Repeat("x", 17) + "日本語",
+		"\xff",
+		strings.Repeat("x", 9) + "\xc3",
+		strings.Repeat("x", 16) + "\xed\xa0\x80", // surrogate
+		"ok\x80ok",
+	}
+	for _, s := range cases {
+		assert.Equal(t, utf8.ValidString(s), ValidUTF8([]byte(s)), "%q", s)
+	}
+}
+
+func TestReader_ValidateUTF8(t *testing.T) {
+	w := &MsgpWriter{}
+	require.NoError(t, w.WriteString("ok"))
+	require.NoError(t, w.WriteStr8("bad\xff"))
+	// Bin payloads are not text and are never checked.
+	require.NoError(t, w.WriteBytes([]byte{0xff}))
+
+	r := &MsgpReader{Buff: w.Buff, ValidateUTF8: true}
+	_, _, data, err := r.Read()
+	require.NoError(t, err)
+	assert.Equal(t, "ok", string(data))
+
+	idx := r.Idx
+	_, _, _, err = r.Read()
+	require.ErrorIs(t, err, ErrInvalidUTF8)
+	assert.Equal(t, idx, r.Idx)
+
+	// Unlike Strict, the non-canonical Str8 header itself is accepted.
+	r.Idx = idx
+	r.ValidateUTF8 = false
+	require.NoError(t, r.Skip())
+	r.ValidateUTF8 = true
+	_, _, _, err = r.Read()
+	require.NoError(t, err)
+}
+
+func TestWriter_ValidateUTF8(t *testing.T) {
+	w := &MsgpWriter{ValidateUTF8: true}
+	require.NoError(t, w.WriteString("héllo"))
+	n := len(w.Buff)
+	require.ErrorIs(t, w.WriteString("a\xffb"), ErrInvalidUTF8)
+	assert.Equal(t, n, len(w.Buff))
+
+	c := NewCheckedWriter(&MsgpWriter{ValidateUTF8: true})
+	require.NoError(t, c.WriteArray(1))
+	require.ErrorIs(t, c.WriteString("\xff"), ErrInvalidUTF8)
+	assert.Equal(t, 1, c.Depth(), "rejected string must not be counted")
+}
+
+func TestValidUTF8_NoAllocs(t *testing.T) {
+	b := []byte(strings.Repeat("abcdefgh", 8) + "日本語")
+	allocs := testing.AllocsPerRun(100, func() {
+		_ = ValidUTF8(b)
+	})
+	require.Zero(t, allocs)
+}
+
+func BenchmarkValidUTF8_ASCII(b *testing.B) {
+	buf := []byte(strings.Repeat("plain ascii text ", 64))
+	b.SetBytes(int64(len(buf)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = ValidUTF8(buf)
+	}
+}
@@ -0,0 +1,385 @@
+package msgpraw
+
+import (
+	"errors"
+	"math"
+	"strconv"
+)
+
+var (
+	ErrMaxDepth   = errors.New("msgpraw: maximum nesting depth exceeded")
+	ErrValueKind  = errors.New("msgpraw: unknown value kind")
+	ErrOddMapArgs = errors.New("msgpraw: map value needs an even number of keys and values")
+)
+
+// maxDepth bounds recursion when decoding nested containers so hostile input
+// such as a long run of 0x91 bytes cannot exhaust the stack.
+const maxDepth = 10000
+
+// Kind identifies which variant a Value holds.
+type Kind uint8
+
+const (
+	KindNil Kind = iota
+	KindBool
+	KindInt
+	KindUint
+	KindFloat
+	KindStr
+	KindBin
+	KindArray
+	KindMap
+	KindExt
+)
+
+var kindNames = [...]string{"nil", "bool", "int", "uint", "float", "str", "bin", "array", "map", "ext"}
+
+func (k Kind) String() string {
+	if int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return "Kind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// kindOf returns the Kind a value with tag t decodes to, and false for an
+// unknown tag.
+func kindOf(t Type) (Kind, bool) {
+	switch {
+	case t <= PosFixIntMax, t >= NegFixInt, t >= Int8 && t <= Int64:
+		return KindInt, true
+	case t >= Uint8 && t <= Uint64:
+		return KindUint, true
+	case t == Float32, t == Float64:
+		return KindFloat, true
+	case t == Nil:
+		return KindNil, true
+	case t == True, t == False:
+		return KindBool, true
+	case t.isStr():
+		return KindStr, true
+	case t.isBin():
+		return KindBin, true
+	case t.isExt():
+		return KindExt, true
+	case t.isArray():
+		return KindArray, true
+	case t.isMap():
+		return KindMap, true
+	}
+	return 0, false
+}
+
+// Value is a decoded msgpack value for schemaless documents.
+//
+// Integers from the signed formats (and PosFixInt/NegFixInt) decode as
+// KindInt, the Uint* formats as KindUint. Str, Bin and Ext payloads are
+// sub-slices of the buffer they were decoded from, not copies. Maps keep
+// their keys in wire order.
+type Value struct {
+	kind  Kind
+	f32   bool
+	ext   int8
+	num   uint64
+	raw   []byte
+	elems []Value // array: elements; map: key, value, key, value, ...
+}
+
+func NilValue() Value             { return Value{kind: KindNil} }
+func IntValue(i int64) Value      { return Value{kind: KindInt, num: uint64(i)} }
+func UintValue(u uint64) Value    { return Value{kind: KindUint, num: u} }
+func StrValue(s string) Value     { return Value{kind: KindStr, raw: []byte(s)} }
+func BinValue(b []byte) Value     { return Value{kind: KindBin, raw: b} }
+func ArrayValue(v ...Value) Value { return Value{kind: KindArray, elems: v} }
+
+func BoolValue(b bool) Value {
+	v := Value{kind: KindBool}
+	if b {
+		v.num = 1
+	}
+	return v
+}
+
+func Float64Value(f float64) Value {
+	return Value{kind: KindFloat, num: math.Float64bits(f)}
+}
+
+// Float32Value holds f as a float and encodes it as Float32.
+func Float32Value(f float32) Value {
+	return Value{kind: KindFloat, f32: true, num: math.Float64bits(float64(f))}
+}
+
+func ExtValue(extType int8, data []byte) Value {
+	return Value{kind: KindExt, ext: extType, raw: data}
+}
+
+// MapValue builds a map from alternating keys and values:
+// MapValue(StrValue("a"), IntValue(1), StrValue("b"), IntValue(2)).
+func MapValue(kv ...Value) (Value, error) {
+	if len(kv)%2 != 0 {
+		return Value{}, ErrOddMapArgs
+	}
+	return Value{kind: KindMap, elems: kv}, nil
+}
+
+func (v Value) Kind() Kind      { return v.kind }
+func (v Value) IsNil() bool     { return v.kind == KindNil }
+func (v Value) Bool() bool      { return v.kind == KindBool && v.num != 0 }
+func (v Value) ExtType() int8   { return v.ext }
+func (v Value) IsFloat32() bool { return v.kind == KindFloat && v.f32 }
+
+// Int returns the integer held by v for KindInt and KindUint, 0 otherwise.
+// KindUint values above math.MaxInt64 wrap.
+func (v Value) Int() int64 {
+	if v.kind != KindInt && v.kind != KindUint {
+		return 0
+	}
+	return int64(v.num)
+}
+
+// Uint returns the integer held by v for KindInt and KindUint, 0 otherwise.
+// Negative KindInt values wrap.
+func (v Value) Uint() uint64 {
+	if v.kind != KindInt && v.kind != KindUint {
+		return 0
+	}
+	return v.num
+}
+
+// Float returns the float held by v, or 0 if v is not KindFloat.
+func (v Value) Float() float64 {
+	if v.kind != KindFloat {
+		return 0
+	}
+	return math.Float64frombits(v.num)
+}
+
+// Bytes returns the payload of a Str, Bin or Ext value (without the ext type
+// byte), or nil for other kinds.
+func (v Value) Bytes() []byte {
+	switch v.kind {
+	case KindStr, KindBin, KindExt:
+		return v.raw
+	}
+	return nil
+}
+
+// Str returns the payload of a Str value as a string, or "" for other kinds.
+func (v Value) Str() string {
+	if v.kind != KindStr {
+		return ""
+	}
+	return string(v.raw)
+}
+
+// Len returns the number of elements of an array or the number of pairs of a
+// map, and 0 for other kinds.
+func (v Value) Len() int {
+	switch v.kind {
+	case KindArray:
+		return len(v.elems)
+	case KindMap:
+		return len(v.elems) / 2
+	}
+	return 0
+}
+
+// Index returns element i of an array. It panics if i is out of range.
+func (v Value) Index(i int) Value { return v.elems[i] }
+
+// Key returns the key of pair i of a map. It panics if i is out of range.
+func (v Value) Key(i int) Value { return v.elems[2*i] }
+
+// Elem returns the value of pair i of a map. It panics if i is out of range.
+func (v Value) Elem(i int) Value { return v.elems[2*i+1] }
+
+// Get returns the value stored under the string key in a map. When a key
+// appears more than once the first pair wins.
+func (v Value) Get(key string) (Value, bool) {
+	if v.kind != KindMap {
+		return Value{}, false
+	}
+	for i := 0; i < len(v.elems); i += 2 {
+		if k := v.elems[i]; k.kind == KindStr && string(k.raw) == key {
+			return v.elems[i+1], true
+		}
+	}
+	return Value{}, false
+}
+
+// GetInt returns the value stored under the integer key in a map, matching
+// KindInt and KindUint keys by numeric value. When a key appears more than
+// once the first pair wins.
+func (v Value) GetInt(key int64) (Value, bool) {
+	if v.kind != KindMap {
+		return Value{}, false
+	}
+	for i := 0; i < len(v.elems); i += 2 {
+		k := v.elems[i]
+		if (k.kind == KindInt || (k.kind == KindUint && int64(k.num) >= 0)) && int64(k.num) == key {
+			return v.elems[i+1], true
+		}
+	}
+	return Value{}, false
+}
+
+// Arena allocates every node of a decoded document from one slab, so decoding
+// a document costs at most one allocation and steady-state decoding with a
+// reused Arena costs none. Values decoded through an Arena stay valid until
+// Reset is called.
+type Arena struct {
+	slab []Value
+}
+
+// Reset makes the arena's memory available for reuse. Values previously
+// decoded through the arena must not be used afterwards.
+func (a *Arena) Reset() {
+	a.slab = a.slab[:0]
+}
+
+func (a *Arena) alloc(n int) []Value {
+	start := len(a.slab)
+	a.slab = a.slab[:start+n]
+	s := a.slab[start : start+n : start+n]
+	for i := range s {
+		s[i] = Value{}
+	}
+	return s
+}
+
+// DecodeValue decodes the next value from r like the package-level
+// DecodeValue, taking all container nodes from the arena's slab.
+func (a *Arena) DecodeValue(r *MsgpReader) (Value, error) {
+	// The probe starts without r's key tracker, which it would corrupt.
+	probe := MsgpReader{Buff: r.Buff, Idx: r.Idx, Strict: r.Strict, ValidateUTF8: r.ValidateUTF8}
+	nodes, err := probe.skipValue()
+	if err != nil {
+		r.Idx = probe.Idx
+		return Value{}, err
+	}
+	// The root is returned by value, only its descendants need a slot.
+	if need := len(a.slab) + nodes - 1; need > cap(a.slab) {
+		// Earlier values keep referencing the old slab, so it is left
+		// untouched rather than copied.
+		size := need - len(a.slab)
+		if size < 2*cap(a.slab) {
+			size = 2 * cap(a.slab)
+		}
+		a.slab = make([]Value, 0, size)
+	}
+	var v Value
+	err = decodeValue(r, &v, a, 0)
+	return v, err
+}
+
+// DecodeValue decodes the next complete value from r, including all nested
+// children, and advances r past it. It returns EOF if r is exhausted.
+func DecodeValue(r *MsgpReader) (Value, error) {
+	var v Value
+	err := decodeValue(r, &v, nil, 0)
+	return v, err
+}
+
+func decodeValue(r *MsgpReader, v *Value, a *Arena, depth int) error {
+	if depth > maxDepth {
+		return ErrMaxDepth
+	}
+	t, n, data, err := r.Read()
+	if err != nil {
+		if err == EOF && depth > 0 {
+			return ErrTruncated
+		}
+		return err
+	}
+
+	switch {
+	case t == Nil:
+		*v = Value{kind: KindNil}
+	case t == True, t == False:
+		*v = BoolValue(t == True)
+	case t == Float32, t == Float64:
+		f, _ := floatPayload(t, data)
+		*v = Value{kind: KindFloat, f32: t == Float32, num: math.Float64bits(f)}
+	case t.isStr():
+		*v = Value{kind: KindStr, raw: data}
+	case t.isBin():
+		*v = Value{kind: KindBin, raw: data}
+	case t.isExt():
+		*v = Value{kind: KindExt, ext: int8(data[0]), raw: data[1:]}
+	case t.isArray(), t.isMap():
+		kind, count := KindArray, n
+		if t.isMap() {
+			kind, count = KindMap, 2*n
+		}
+		var elems []Value
+		if a != nil {
+			elems = a.alloc(count)
+		} else {
+			// Every element takes at least one byte; refuse to allocate for
+			// counts the remaining input cannot possibly hold.
+			if count > len(r.Buff)-r.Idx {
+				return ErrTruncated
+			}
+			elems = make([]Value, count)
+		}
+		for i := range elems {
+			if err := decodeValue(r, &elems[i], a, depth+1); err != nil {
+				return err
+			}
+		}
+		*v = Value{kind: kind, elems: elems}
+	default:
+		i, isUint, _ := intPayload(t, data)
+		if isUint {
+			*v = Value{kind: KindUint, num: uint64(i)}
+		} else {
+			*v = Value{kind: KindInt, num: uint64(i)}
+		}
+	}
+	return nil
+}
+
+// EncodeValue writes v to w. Integers use the shortest format that holds
+// them (so a KindInt of 200 reads back as KindUint); strings, binaries,
+// arrays, maps and exts use the auto-sized writers.
+func EncodeValue(w *MsgpWriter, v Value) error {
+	switch v.kind {
+	case KindNil:
+		return w.WriteNil()
+	case KindBool:
+		return w.WriteBool(v.num != 0)
+	case KindInt:
+		return w.writeIntCompact(int64(v.num))
+	case KindUint:
+		return w.writeUintCompact(v.num)
+	case KindFloat:
+		if v.f32 {
+			return w.WriteFloat32(float32(math.Float64frombits(v.num)))
+		}
+		return w.WriteFloat64(math.Float64frombits(v.num))
+	case KindStr:
+		return w.WriteString(string(v.raw))
+	case KindBin:
+		return w.WriteBytes(v.raw)
+	case KindExt:
+		return w.WriteExt(v.ext, v.raw)
+	case KindArray:
+		if err := w.WriteArray(len(v.elems)); err != nil {
+			return err
+		}
+	case KindMap:
+		if len(v.elems)%2 != 0 {
+			return ErrOddMapArgs
+		}
+		if err := w.WriteMap(len(v.elems) / 2); err != nil {
+			return err
+		}
+	default:
+		return ErrValueKind
+	}
+	for _, e := range v.elems {
+		if err := EncodeValue(w, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
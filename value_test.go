@@ -0,0 +1,287 @@
+package msgpraw
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeValue_Scalars(t *testing.T) {
+	w := &MsgpWriter{}
+	require.NoError(t, w.WriteNil())
+	require.NoError(t, w.WriteBool(true))
+	require.NoError(t, w.WritePosFixInt(7))
+	require.NoError(t, w.WriteNegFixInt(-7))
+	require.NoError(t, w.WriteInt16(-300))
+	require.NoError(t, w.WriteUint64(math.MaxUint64))
+	require.NoError(t, w.WriteFloat32(1.5))
+	require.NoError(t, w.WriteFloat64(2.25))
+	require.NoError(t, w.WriteString("hi"))
+	require.NoError(t, w.WriteBytes([]byte{1, 2}))
+	require.NoError(t, w.WriteFixExt1(5, []byte{0xaa}))
+
+	r := &MsgpReader{Buff: w.Buff}
+	next := func() Value {
+		v, err := DecodeValue(r)
+		require.NoError(t, err)
+		return v
+	}
+
+	assert.True(t, next().IsNil())
+	assert.True(t, next().Bool())
+
+	v := next()
+	assert.Equal(t, KindInt, v.Kind())
+	assert.Equal(t, int64(7), v.Int())
+
+	v = next()
+	assert.Equal(t, KindInt, v.Kind())
+	assert.Equal(t, int64(-7), v.Int())
+
+	assert.Equal(t, int64(-300), next().Int())
+
+	v = next()
+	assert.Equal(t, KindUint, v.Kind())
+	assert.Equal(t, uint64(math.MaxUint64), v.Uint())
+
+	v = next()
+	assert.True(t, v.IsFloat32())
+	assert.Equal(t, 1.5, v.Float())
+
+	v = next()
+	assert.False(t, v.IsFloat32())
+	assert.Equal(t, 2.25, v.Float())
+
+	assert.Equal(t, "hi", next().Str())
+
+	v = next()
+	assert.Equal(t, KindBin, v.Kind())
+	assert.Equal(t, []byte{1, 2}, v.Bytes())
+
+	v = next()
+	assert.Equal(t, KindExt, v.Kind())
+	assert.Equal(t, int8(5), v.ExtType())
+	assert.Equal(t, []byte{0xaa}, v.Bytes())
+
+	_, err := DecodeValue(r)
+	require.ErrorIs(t, err, EOF)
+}
+
+func TestDecodeValue_Nested(t *testing.T) {
+	w := &MsgpWriter{}
+	require.NoError(t, w.WriteMap(2))
+	require.NoError(t, w.WriteString("b"))
+	require.NoError(t, w.WriteArray(2))
+	require.NoError(t, w.WritePosFixInt(1))
+	require.NoError(t, w.WriteMap(1))
+	require.NoError(t, w.WriteString("x"))
+	require.NoError(t, w.WriteNil())
+	require.NoError(t, w.WriteString("a"))
+	require.NoError(t, w.WriteBool(false))
+
+	r := &MsgpReader{Buff: w.Buff}
+	v, err := DecodeValue(r)
+	require.NoError(t, err)
+	assert.Equal(t, len(w.Buff), r.Idx)
+
+	require.Equal(t, KindMap, v.Kind())
+	require.Equal(t, 2, v.Len())
+	// Keys keep wire order.
+	assert.Equal(t, "b", v.Key(0).Str())
+	assert.Equal(t, "a", v.Key(1).Str())
+
+	b, ok := v.Get("b")
+	require.True(t, ok)
+	require.Equal(t, 2, b.Len())
+	assert.Equal(t, int64(1), b.Index(0).Int())
+	x, ok := b.Index(1).Get("x")
+	require.True(t, ok)
+	assert.True(t, x.IsNil())
+
+	_, ok = v.Get("missing")
+	assert.False(t, ok)
+}
+
+func TestDecodeValue_Errors(t *testing.T) {
+	cases := []struct {
+		name string
+		buf  []byte
+		err  error
+	}{
+		{"truncated_scalar", []byte{byte(Int16), 0x01}, ErrTruncated},
+		{"missing_element", []byte{byte(FixArray) | 2, 0x01}, ErrTruncated},
+		{"huge_count", []byte{byte(Array32), 0xff, 0xff, 0xff, 0xff, 0x01}, ErrTruncated},
+		{"unknown", []byte{byte(FixArray) | 1, 0xc1}, ErrUnknownType},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := DecodeValue(&MsgpReader{Buff: tc.buf})
+			require.ErrorIs(t, err, tc.err)
+
+			_, err = new(Arena).DecodeValue(&MsgpReader{Buff: tc.buf})
+			require.ErrorIs(t, err, tc.err)
+		})
+	}
+}
+
+func TestDecodeValue_MaxDepth(t *testing.T) {
+	buf := make([]byte, maxDepth+2)
+	for i := range buf {
+		buf[i] = byte(FixArray) | 1
+	}
+	buf[len(buf)-1] = byte(Nil)
+	_, err := DecodeValue(&MsgpReader{Buff: buf})
+	require.ErrorIs(t, err, ErrMaxDepth)
+}
+
+func TestEncodeValue_RoundTrip(t *testing.T) {
+	inner, err := MapValue(StrValue("k"), ArrayValue(NilValue(), BoolValue(true)))
+	require.NoError(t, err)
+	root := ArrayValue(
+		IntValue(-1),
+		IntValue(-200),
+		UintValue(1<<40),
+		Float32Value(0.5),
+		Float64Value(0.25),
+		StrValue("hello"),
+		BinValue([]byte{9}),
+		ExtValue(-3, []byte{1, 2, 3}),
+		inner,
+	)
+
+	w := &MsgpWriter{}
+	require.NoError(t, EncodeValue(w, root))
+
+	got, err := DecodeValue(&MsgpReader{Buff: w.Buff})
+	require.NoError(t, err)
+	require.Equal(t, root.Len(), got.Len())
+	assert.Equal(t, int64(-1), got.Index(0).Int())
+	assert.Equal(t, int64(-200), got.Index(1).Int())
+	assert.Equal(t, uint64(1<<40), got.Index(2).Uint())
+	assert.True(t, got.Index(3).IsFloat32())
+	assert.Equal(t, 0.25, got.Index(4).Float())
+	assert.Equal(t, "hello", got.Index(5).Str())
+	assert.Equal(t, []byte{9}, got.Index(6).Bytes())
+	assert.Equal(t, int8(-3), got.Index(7).ExtType())
+	k, ok := got.Index(8).Get("k")
+	require.True(t, ok)
+	assert.True(t, k.Index(1).Bool())
+
+	// Re-encoding the decoded tree gives identical bytes.
+	w2 := &MsgpWriter{}
+	require.NoError(t, EncodeValue(w2, got))
+	assert.Equal(t, w.Buff, w2.Buff)
+}
+
+func TestEncodeValue_CompactInts(t *testing.T) {
+	cases := []struct {
+		v    Value
+		want []byte
+	}{
+		{IntValue(5), []byte{0x05}},
+		{IntValue(-5), []byte{0xfb}},
+		{IntValue(200), []byte{byte(Uint8), 200}},
+		{IntValue(-100), []byte{byte(Int8), 0x9c}},
+		{IntValue(-1000), []byte{byte(Int16), 0xfc, 0x18}},
+		{UintValue(70000), []byte{byte(Uint32), 0x00, 0x01, 0x11, 0x70}},
+	}
+	for _, tc := range cases {
+		w := &MsgpWriter{}
+		require.NoError(t, EncodeValue(w, tc.v))
+		assert.Equal(t, tc.want, w.Buff)
+	}
+}
+
+func TestMapValue_Odd(t *testing.T) {
+	_, err := MapValue(StrValue("a"))
+	require.ErrorIs(t, err, ErrOddMapArgs)
+}
+
+func TestArena_DecodeValue(t *testing.T) {
+	w := &MsgpWriter{}
+	require.NoError(t, w.WriteArray(3))
+	require.NoError(t, w.WriteString("a"))
+	require.NoError(t, w.WriteMap(1))
+	require.NoError(t, w.WritePosFixInt(1))
+	require.NoError(t, w.WritePosFixInt(2))
+	require.NoError(t, w.WriteNil())
+
+	var a Arena
+	r := &MsgpReader{Buff: w.Buff}
+	v, err := a.DecodeValue(r)
+	require.NoError(t, err)
+	// 3 elements + 2 map slots share one slab.
+	assert.Equal(t, 5, len(a.slab))
+	assert.Equal(t, "a", v.Index(0).Str())
+	assert.Equal(t, int64(2), v.Index(1).Elem(0).Int())
+
+	// The full slab is replaced by a larger one; the first document keeps
+	// pointing at the old slab and stays intact.
+	v2, err := a.DecodeValue(&MsgpReader{Buff: w.Buff})
+	require.NoError(t, err)
+	assert.Equal(t, 10, cap(a.slab))
+	assert.Equal(t, "a", v.Index(0).Str())
+	assert.Equal(t, "a", v2.Index(0).Str())
+}
+
+func TestArena_NoAllocs(t *testing.T) {
+	buf := allTagsFixture(t)
+	w := &MsgpWriter{}
+	require.NoError(t, w.WriteArray(3))
+	require.NoError(t, w.WriteString("a"))
+	require.NoError(t, w.WriteArray(2))
+	require.NoError(t, w.WriteNil())
+	require.NoError(t, w.WriteInt(1))
+	require.NoError(t, w.WriteBytes(buf[:10]))
+
+	var a Arena
+	_, err := a.DecodeValue(&MsgpReader{Buff: w.Buff})
+	require.NoError(t, err)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		a.Reset()
+		r := MsgpReader{Buff: w.Buff}
+		_, _ = a.DecodeValue(&r)
+	})
+	require.Zero(t, allocs, "reused Arena must not allocate")
+}
+
+func BenchmarkDecodeValue_Arena(b *testing.B) {
+	w := &MsgpWriter{}
+	_ = w.WriteArray(100)
+	for i := 0; i < 100; i++ {
+		_ = w.WriteMap(2)
+		_ = w.WriteString("id")
+		_ = w.WriteInt(i)
+		_ = w.WriteString("tags")
+		_ = w.WriteArray(2)
+		_ = w.WriteString("x")
+		_ = w.WriteString("y")
+	}
+	var a Arena
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		a.Reset()
+		r := MsgpReader{Buff: w.Buff}
+		_, _ = a.DecodeValue(&r)
+	}
+}
+
+func TestValue_GetInt(t *testing.T) {
+	v, err := DecodeValue(&MsgpReader{Buff: compactKeysFixture(t)})
+	require.NoError(t, err)
+	for key, want := range map[int64]string{5: "five", -2: "minus two", 300: "three hundred"} {
+		e, ok := v.GetInt(key)
+		require.True(t, ok)
+		assert.Equal(t, want, e.Str())
+	}
+	for _, key := range []int64{-1 << 63, 7} {
+		_, ok := v.GetInt(key)
+		assert.False(t, ok)
+	}
+	_, ok := IntValue(1).GetInt(1)
+	assert.False(t, ok)
+}
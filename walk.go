@@ -0,0 +1,171 @@
+package msgpraw
+
+import "errors"
+
+var (
+	// SkipSubtree returned from OnArrayStart or OnMapStart makes Walk skip the
+	// container's children and its End callback; returned from OnMapValue it
+	// skips that value. Other callbacks treat it like nil.
+	SkipSubtree = errors.New("msgpraw: skip subtree")
+	// SkipAll returned from any callback stops Walk, which then returns nil.
+	SkipAll = errors.New("msgpraw: skip all")
+)
+
+// Visitor receives the events of Walk. Str, Bin and Ext payloads are
+// sub-slices of the walked buffer, not copies. Any error other than
+// SkipSubtree and SkipAll stops the walk and is returned by Walk.
+type Visitor interface {
+	OnNil() error
+	OnBool(v bool) error
+	// OnInt receives signed formats and the fixints.
+	OnInt(v int64) error
+	// OnUint receives the Uint8..Uint64 formats.
+	OnUint(v uint64) error
+	OnFloat32(v float32) error
+	OnFloat64(v float64) error
+	OnStr(data []byte) error
+	OnBin(data []byte) error
+	OnExt(extType int8, data []byte) error
+	OnArrayStart(n int) error
+	OnArrayEnd() error
+	OnMapStart(n int) error
+	// OnMapKey is called before the i-th key is visited, OnMapValue before
+	// its value.
+	OnMapKey(i int) error
+	OnMapValue(i int) error
+	OnMapEnd() error
+}
+
+// NopVisitor implements every Visitor method as a no-op. Embed it to
+// implement only the callbacks you need.
+type NopVisitor struct{}
+
+func (NopVisitor) OnNil() error             { return nil }
+func (NopVisitor) OnBool(bool) error        { return nil }
+func (NopVisitor) OnInt(int64) error        { return nil }
+func (NopVisitor) OnUint(uint64) error      { return nil }
+func (NopVisitor) OnFloat32(float32) error  { return nil }
+func (NopVisitor) OnFloat64(float64) error  { return nil }
+func (NopVisitor) OnStr([]byte) error       { return nil }
+func (NopVisitor) OnBin([]byte) error       { return nil }
+func (NopVisitor) OnExt(int8, []byte) error { return nil }
+func (NopVisitor) OnArrayStart(int) error   { return nil }
+func (NopVisitor) OnArrayEnd() error        { return nil }
+func (NopVisitor) OnMapStart(int) error     { return nil }
+func (NopVisitor) OnMapKey(int) error       { return nil }
+func (NopVisitor) OnMapValue(int) error     { return nil }
+func (NopVisitor) OnMapEnd() error          { return nil }
+
+// Walk visits every value in buf depth-first, calling v for each event.
+func Walk(buf []byte, v Visitor) error {
+	r := &MsgpReader{Buff: buf}
+	for r.Idx < len(r.Buff) {
+		if err := walkValue(r, v, 0); err != nil {
+			if err == SkipAll {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func walkValue(r *MsgpReader, v Visitor, depth int) error {
+	if depth > maxDepth {
+		return ErrMaxDepth
+	}
+	t, n, data, err := r.Read()
+	if err == EOF && depth > 0 {
+		err = ErrTruncated
+	}
+	if err != nil {
+		return err
+	}
+
+	if i, isUint, ok := intPayload(t, data); ok {
+		if isUint {
+			return skipIgnored(v.OnUint(uint64(i)))
+		}
+		return skipIgnored(v.OnInt(i))
+	}
+	switch {
+	case t == Nil:
+		return skipIgnored(v.OnNil())
+	case t == True, t == False:
+		return skipIgnored(v.OnBool(t == True))
+	case t == Float32:
+		f, _ := floatPayload(t, data)
+		return skipIgnored(v.OnFloat32(float32(f)))
+	case t == Float64:
+		f, _ := floatPayload(t, data)
+		return skipIgnored(v.OnFloat64(f))
+	case t.isStr():
+		return skipIgnored(v.OnStr(data))
+	case t.isBin():
+		return skipIgnored(v.OnBin(data))
+	case t.isExt():
+		return skipIgnored(v.OnExt(int8(data[0]), data[1:]))
+	case t.isArray():
+		if err := v.OnArrayStart(n); err != nil {
+			if err == SkipSubtree {
+				return skipChildren(r, n)
+			}
+			return err
+		}
+		for i := 0; i < n; i++ {
+			if err := walkValue(r, v, depth+1); err != nil {
+				return err
+			}
+		}
+		return skipIgnored(v.OnArrayEnd())
+	case t.isMap():
+		if err := v.OnMapStart(n); err != nil {
+			if err == SkipSubtree {
+				return skipChildren(r, 2*n)
+			}
+			return err
+		}
+		for i := 0; i < n; i++ {
+			if err := skipIgnored(v.OnMapKey(i)); err != nil {
+				return err
+			}
+			if err := walkValue(r, v, depth+1); err != nil {
+				return err
+			}
+			if err := v.OnMapValue(i); err != nil {
+				if err != SkipSubtree {
+					return err
+				}
+				if err := skipChildren(r, 1); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := walkValue(r, v, depth+1); err != nil {
+				return err
+			}
+		}
+		return skipIgnored(v.OnMapEnd())
+	}
+	return ErrUnknownType
+}
+
+func skipIgnored(err error) error {
+	if err == SkipSubtree {
+		return nil
+	}
+	return err
+}
+
+// skipChildren skips n values inside a container.
+func skipChildren(r *MsgpReader, n int) error {
+	for i := 0; i < n; i++ {
+		if err := r.SkipValue(); err != nil {
+			if err == EOF {
+				err = ErrTruncated
+			}
+			return err
+		}
+	}
+	return nil
+}
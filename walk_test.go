@@ -0,0 +1,133 @@
+package msgpraw
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// traceVisitor records every event as a string.
+type traceVisitor struct {
+	events []string
+	// ret maps an event to the error its callback returns.
+	ret map[string]error
+}
+
+func (v *traceVisitor) add(format string, args ...any) error {
+	e := fmt.Sprintf(format, args...)
+	v.events = append(v.events, e)
+	return v.ret[e]
+}
+
+func (v *traceVisitor) OnNil() error                 { return v.add("nil") }
+func (v *traceVisitor) OnBool(b bool) error          { return v.add("bool %v", b) }
+func (v *traceVisitor) OnInt(i int64) error          { return v.add("int %d", i) }
+func (v *traceVisitor) OnUint(u uint64) error        { return v.add("uint %d", u) }
+func (v *traceVisitor) OnFloat32(f float32) error    { return v.add("f32 %v", f) }
+func (v *traceVisitor) OnFloat64(f float64) error    { return v.add("f64 %v", f) }
+func (v *traceVisitor) OnStr(b []byte) error         { return v.add("str %s", b) }
+func (v *traceVisitor) OnBin(b []byte) error         { return v.add("bin %x", b) }
+func (v *traceVisitor) OnExt(t int8, b []byte) error { return v.add("ext %d %x", t, b) }
+func (v *traceVisitor) OnArrayStart(n int) error     { return v.add("[%d", n) }
+func (v *traceVisitor) OnArrayEnd() error            { return v.add("]") }
+func (v *traceVisitor) OnMapStart(n int) error       { return v.add("{%d", n) }
+func (v *traceVisitor) OnMapKey(i int) error         { return v.add("key %d", i) }
+func (v *traceVisitor) OnMapValue(i int) error       { return v.add("value %d", i) }
+func (v *traceVisitor) OnMapEnd() error              { return v.add("}") }
+
+func walkFixture(t *testing.T) []byte {
+	w := &MsgpWriter{}
+	require.NoError(t, w.WriteMap(2))
+	require.NoError(t, w.WriteString("a"))
+	require.NoError(t, w.WriteArray(3))
+	require.NoError(t, w.WriteNil())
+	require.NoError(t, w.WriteNegFixInt(-2))
+	require.NoError(t, w.WriteUint16(300))
+	require.NoError(t, w.WriteString("b"))
+	require.NoError(t, w.WriteMap(1))
+	require.NoError(t, w.WriteBytes([]byte{0xab}))
+	require.NoError(t, w.WriteFixExt1(4, []byte{0xcd}))
+	require.NoError(t, w.WriteFloat32(1.5))
+	require.NoError(t, w.WriteFloat64(0.25))
+	require.NoError(t, w.WriteBool(false))
+	return w.Buff
+}
+
+func TestWalk(t *testing.T) {
+	v := &traceVisitor{}
+	require.NoError(t, Walk(walkFixture(t), v))
+	assert.Equal(t, []string{
+		"{2",
+		"key 0", "str a", "value 0",
+		"[3", "nil", "int -2", "uint 300", "]",
+		"key 1", "str b", "value 1",
+		"{1", "key 0", "bin ab", "value 0", "ext 4 cd", "}",
+		"}",
+		"f32 1.5", "f64 0.25", "bool false",
+	}, v.events)
+}
+
+func TestWalk_SkipSubtree(t *testing.T) {
+	v := &traceVisitor{ret: map[string]error{
+		"[3":      SkipSubtree,
+		"value 1": SkipSubtree,
+		"nil":     SkipSubtree, // ignored: nothing to skip
+	}}
+	require.NoError(t, Walk(walkFixture(t), v))
+	assert.Equal(t, []string{
+		"{2",
+		"key 0", "str a", "value 0", "[3",
+		"key 1", "str b", "value 1",
+		"}",
+		"f32 1.5", "f64 0.25", "bool false",
+	}, v.events)
+}
+
+func TestWalk_Stop(t *testing.T) {
+	v := &traceVisitor{ret: map[string]error{"uint 300": SkipAll}}
+	require.NoError(t, Walk(walkFixture(t), v))
+	assert.Equal(t, "uint 300", v.events[len(v.events)-1])
+
+	boom := errors.New("boom")
+	v = &traceVisitor{ret: map[string]error{"str b": boom}}
+	require.ErrorIs(t, Walk(walkFixture(t), v), boom)
+}
+
+func TestWalk_Errors(t *testing.T) {
+	require.ErrorIs(t, Walk([]byte{byte(FixArray) | 2, byte(Nil)}, NopVisitor{}), ErrTruncated)
+	require.ErrorIs(t, Walk([]byte{byte(FixMap) | 1, byte(Nil)}, NopVisitor{}), ErrTruncated)
+	require.ErrorIs(t, Walk([]byte{0xc1}, NopVisitor{}), ErrUnknownType)
+
+	skip := &traceVisitor{ret: map[string]error{"[2": SkipSubtree}}
+	require.ErrorIs(t, Walk([]byte{byte(FixArray) | 2, byte(Nil)}, skip), ErrTruncated)
+
+	deep := []byte(strings.Repeat(string([]byte{byte(FixArray) | 1}), maxDepth+2))
+	require.ErrorIs(t, Walk(deep, NopVisitor{}), ErrMaxDepth)
+}
+
+// countVisitor only overrides what it needs.
+type countVisitor struct {
+	NopVisitor
+	strs int
+}
+
+func (c *countVisitor) OnStr([]byte) error { c.strs++; return nil }
+
+func TestWalk_NopVisitor(t *testing.T) {
+	c := &countVisitor{}
+	require.NoError(t, Walk(allTagsFixture(t), c))
+	assert.Positive(t, c.strs)
+}
+
+func TestWalk_NoAllocs(t *testing.T) {
+	buf := allTagsFixture(t)
+	c := &countVisitor{}
+	allocs := testing.AllocsPerRun(100, func() {
+		_ = Walk(buf, c)
+	})
+	require.Zero(t, allocs)
+}